@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// adminTtl is how long a user's admin status from Slack is remembered, so someone who's made or stops being a
+// workspace admin gets their new permissions within a few minutes
+const adminTtl = 5 * time.Minute
+
+// Limits on how many entries `admin log` shows
+const (
+	defaultAdminLogEntries = 10
+	maxAdminLogEntries     = 50
+)
+
+const adminUsage = "Usage:\n" +
+	">`admin grant @from @to :emoji: [count] <reason>` gives kudos on someone's behalf\n" +
+	">`admin adjust @from @to :emoji: <+count|-count> <reason>` adds to or removes from the kudos given\n" +
+	">`admin void <message link> <reason>` withdraws all the kudos given by a message\n" +
+	">`admin log [count]` shows the latest admin actions"
+
+// messageLinkPattern matches a link to a Slack message, such as https://test.slack.com/archives/C123/p1600000000000002.
+// Slack wraps links in angle brackets and may add the link's text after a pipe, which is left out.
+var messageLinkPattern = regexp.MustCompile("^<?https://[^/]+/archives/([A-Z0-9]+)/p([0-9]{7,})(?:[?][^|>]*)?(?:\\|[^>]*)?>?$")
+
+// slackAdmins caches whether users are admins or owners of the Slack workspace, by Slack id
+var slackAdmins = newCache("slack admins", adminTtl)
+
+// requiresAdmin determines if only admins are allowed to run the command. Managing channels and moderating kudos is
+// left to admins, everything else is open to everyone.
+func requiresAdmin(cmd string) bool {
+	switch cmd {
+	case EnableText, DisableText, ConfigText, AuditText, AdminText:
+		return true
+	}
+	return false
+}
+
+// isAdmin determines if the Slack user is a HeyKudos admin. Admins are the users listed in the configuration, either
+// by Slack id or username, along with the admins and owners of the Slack workspace.
+func isAdmin(slackId string, api Chat) bool {
+	for _, admin := range BotConfig.Admins {
+		if admin == slackId {
+			return true
+		}
+	}
+
+	if admin, ok := slackAdmins.Get(slackId); ok {
+		return admin.(bool)
+	}
+
+	info, err := api.GetUserInfo(slackId)
+	if err != nil {
+		log.Printf("Failed to check if %v is an admin: %v\n", slackId, err)
+		return false
+	}
+
+	admin := info.IsAdmin || info.IsOwner || info.IsPrimaryOwner
+	for _, name := range BotConfig.Admins {
+		if strings.TrimPrefix(name, "@") == info.Name {
+			admin = true
+		}
+	}
+	slackAdmins.Set(slackId, admin)
+	return admin
+}
+
+// notAdmin tells the user they aren't allowed to run the command. Only they can see the refusal.
+func notAdmin(req *Request, api Chat, cmd string) {
+	log.Printf("Refused %v to %v, not an admin\n", cmd, req.User)
+	err := req.Reply(api, true, fmt.Sprintf("Sorry, only HeyKudos admins can use `%v`.", cmd))
+	if err != nil {
+		log.Printf("Error while responding to command in %v: %v\n", req.Channel, err)
+	}
+}
+
+// AdminCommand handles `@heykudos admin`, which lets admins fix kudos which were given by mistake or abused. Every
+// change is written to the admin log along with who made it, why, and the totals before and after.
+func AdminCommand(req *Request, api Chat, store Store) {
+	fields := strings.Fields(strings.TrimPrefix(req.Text, CommandText))
+	if len(fields) < 2 {
+		replyConfig(req, api, adminUsage)
+		return
+	}
+
+	admin, err := GetUser(req.User, api, store)
+	if err != nil {
+		log.Printf("Failed to get info for admin %v: %v\n", req.User, err)
+		return
+	}
+
+	switch strings.ToLower(fields[1]) {
+	case AdminGrant, AdminAdjust:
+		adjustKudos(req, admin, strings.ToLower(fields[1]), fields[2:], api, store)
+	case AdminVoid:
+		voidMessage(req, admin, fields[2:], api, store)
+	case "log":
+		showAdminLog(req, admin, fields[2:], api, store)
+	default:
+		replyConfig(req, api, adminUsage)
+	}
+}
+
+// adjustKudos handles `admin grant` and `admin adjust`. Grants give a positive number of kudos, one by default, while
+// adjustments add or remove the given number.
+func adjustKudos(req *Request, admin *User, action string, args []string, api Chat, store Store) {
+	if len(args) < 4 {
+		replyConfig(req, api, adminUsage)
+		return
+	}
+
+	from, to := mentionedUser(args[0]), mentionedUser(args[1])
+	name := strings.Trim(args[2], ":")
+	isEmojiName := len(args[2]) > 2 && strings.HasPrefix(args[2], ":") && strings.HasSuffix(args[2], ":")
+	if from == "" || to == "" || !isEmojiName {
+		replyConfig(req, api, adminUsage)
+		return
+	}
+	emoji, ok := canonicalEmoji(name)
+	if !ok {
+		replyConfig(req, api, fmt.Sprintf("Sorry, `:%v:` isn't an emoji I know.", name))
+		return
+	}
+
+	count := int64(1)
+	reason := args[3:]
+	n, err := strconv.ParseInt(args[3], 10, 64)
+	if err == nil {
+		count = n
+		reason = args[4:]
+	} else if action == AdminAdjust {
+		replyConfig(req, api, adminUsage)
+		return
+	}
+	if count == 0 || (action == AdminGrant && count < 0) || len(reason) == 0 {
+		replyConfig(req, api, adminUsage)
+		return
+	}
+	if from == to {
+		replyConfig(req, api, "Sorry, users can't give kudos to themselves.")
+		return
+	}
+
+	sender, err := GetUser(from, api, store)
+	if err != nil {
+		replyConfig(req, api, fmt.Sprintf("Sorry, I couldn't find <@%v>.", from))
+		return
+	}
+	recipient, err := GetUser(to, api, store)
+	if err != nil {
+		replyConfig(req, api, fmt.Sprintf("Sorry, I couldn't find <@%v>.", to))
+		return
+	}
+
+	grant := &Grant{
+		Sender:    sender.Id,
+		Recipient: recipient.Id,
+		Emoji:     emoji,
+		Count:     count,
+		Points:    count * int64(BotConfig.EmojiWeight(emoji)),
+	}
+	entry := &AdminAction{
+		Admin:         admin.Id,
+		Action:        action,
+		Reason:        strings.Join(reason, " "),
+		AdminName:     admin.Username,
+		SenderName:    sender.Username,
+		RecipientName: recipient.Username,
+	}
+	ok, err = store.AdjustKudos(entry, grant)
+	if err != nil {
+		log.Printf("Failed to %v kudos from %v to %v: %v\n", action, sender.Username, recipient.Username, err)
+		replyConfig(req, api, "Sorry, something went wrong while changing the kudos.")
+		return
+	}
+	if !ok {
+		replyConfig(req, api, fmt.Sprintf("`%v` hasn't given `%v` any :%v: kudos, so there's nothing to remove.",
+			sender.Username, recipient.Username, emoji))
+		return
+	}
+	log.Printf("Admin %v changed the kudos from %v to %v by %v :%v:\n", admin.Username, sender.Username,
+		recipient.Username, grant.Count, emoji)
+
+	replyConfig(req, api, formatAdminAction(entry, admin.Location()))
+
+	if grant.Count > 0 {
+		giveString := createGiveString([]*Sent{{emoji, grant.Count}})
+		SendMessage(sender, fmt.Sprintf("An admin gave `%v` kudos (%v) on your behalf. Reason: %v", recipient.Username,
+			giveString, entry.Reason), api)
+		SendMessage(recipient, fmt.Sprintf("An admin gave you kudos (%v) from `%v`. Reason: %v", giveString,
+			sender.Username, entry.Reason), api)
+	} else {
+		giveString := createGiveString([]*Sent{{emoji, -grant.Count}})
+		SendMessage(sender, fmt.Sprintf("An admin removed kudos (%v) you gave `%v`. Reason: %v", giveString,
+			recipient.Username, entry.Reason), api)
+		SendMessage(recipient, fmt.Sprintf("An admin removed kudos (%v) you received from `%v`. Reason: %v", giveString,
+			sender.Username, entry.Reason), api)
+	}
+}
+
+// voidMessage handles `admin void`, withdrawing all the kudos given by the linked message the same way they're
+// withdrawn when the message is deleted
+func voidMessage(req *Request, admin *User, args []string, api Chat, store Store) {
+	if len(args) < 2 {
+		replyConfig(req, api, adminUsage)
+		return
+	}
+	channel, messageTs, ok := parseMessageLink(args[0])
+	if !ok {
+		replyConfig(req, api, fmt.Sprintf("Sorry, %v isn't a link to a message.", args[0]))
+		return
+	}
+	reason := strings.Join(args[1:], " ")
+
+	grants, err := store.GrantsForMessage(channel, messageTs)
+	if err != nil {
+		log.Printf("Failed to find kudos for message %v in %v: %v\n", messageTs, channel, err)
+		replyConfig(req, api, "Sorry, something went wrong while looking up the kudos.")
+		return
+	}
+	if len(grants) == 0 {
+		replyConfig(req, api, "There aren't any kudos to void from that message.")
+		return
+	}
+
+	entries := make([]*AdminAction, 0, len(grants))
+	revoke := func(grant *Grant, refund *Allowance) (bool, error) {
+		entry := &AdminAction{Admin: admin.Id, Action: AdminVoid, Reason: reason}
+		ok, err := store.VoidGrant(entry, grant, refund)
+		if ok {
+			entries = append(entries, entry)
+		}
+		return ok, err
+	}
+	log.Printf("%v is voiding %v grants from message %v in %v\n", admin.Username, len(grants), messageTs, channel)
+	withdrawGrants(grants, fmt.Sprintf("an admin voided them. Reason: %v", reason), revoke, api, store)
+
+	if len(entries) == 0 {
+		replyConfig(req, api, "There aren't any kudos to void from that message.")
+		return
+	}
+
+	names := make(map[int64]string)
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("Voided %v kudos grants:", len(entries)))
+	for _, entry := range entries {
+		entry.AdminName = admin.Username
+		entry.SenderName = username(entry.Sender, names, store)
+		entry.RecipientName = username(entry.Recipient, names, store)
+		sb.WriteString("\n>" + formatAdminAction(entry, admin.Location()))
+	}
+	replyConfig(req, api, sb.String())
+}
+
+// showAdminLog handles `admin log`, listing the latest admin actions with the newest first. Times are in the admin's
+// own time zone.
+func showAdminLog(req *Request, admin *User, args []string, api Chat, store Store) {
+	limit := defaultAdminLogEntries
+	if len(args) != 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			replyConfig(req, api, adminUsage)
+			return
+		}
+		limit = n
+	}
+	if limit > maxAdminLogEntries {
+		limit = maxAdminLogEntries
+	}
+
+	entries, err := store.AdminLog(limit)
+	if err != nil {
+		log.Printf("Error while querying the admin log: %v\n", err)
+		replyConfig(req, api, "Sorry, something went wrong while reading the admin log.")
+		return
+	}
+	if len(entries) == 0 {
+		replyConfig(req, api, "No admin has changed any kudos yet.")
+		return
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("*Admin log* (latest %v)", len(entries)))
+	for _, entry := range entries {
+		sb.WriteString("\n>" + formatAdminAction(entry, admin.Location()))
+	}
+	replyConfig(req, api, sb.String())
+}
+
+// formatAdminAction writes out an entry of the admin log, such as
+// "`2019-02-21 14:05` `carol` grant: `alice` to `bob` :taco: `3` → `5` (`3` → `5` points). Reason: missed it"
+func formatAdminAction(entry *AdminAction, loc *time.Location) string {
+	return fmt.Sprintf("`%v` `%v` %v: `%v` to `%v` :%v: `%v` → `%v` (`%v` → `%v` points). Reason: %v",
+		entry.CreatedAt.In(loc).Format("2006-01-02 15:04"), entry.AdminName, entry.Action, entry.SenderName,
+		entry.RecipientName, entry.Emoji, entry.CountBefore, entry.CountAfter, entry.PointsBefore, entry.PointsAfter,
+		entry.Reason)
+}
+
+// mentionedUser returns the Slack id of the user mentioned by the word, or "" if it isn't a mention
+func mentionedUser(word string) string {
+	match := pingPattern.FindStringSubmatch(word)
+	if match == nil || match[0] != word {
+		return ""
+	}
+	return match[1]
+}
+
+// parseMessageLink finds the channel and timestamp of the message a Slack link points to
+func parseMessageLink(link string) (string, string, bool) {
+	match := messageLinkPattern.FindStringSubmatch(link)
+	if match == nil {
+		return "", "", false
+	}
+	ts := match[2]
+	return match[1], ts[:len(ts)-6] + "." + ts[len(ts)-6:], true
+}
+
+// username looks up the username of a user by their database id, remembering the names it's already looked up
+func username(id int64, names map[int64]string, store Store) string {
+	if name, ok := names[id]; ok {
+		return name
+	}
+	user, err := store.UserById(id)
+	if err != nil {
+		log.Printf("Failed to get info for user %v: %v\n", id, err)
+		return "unknown"
+	}
+	names[id] = user.Username
+	return user.Username
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOnlyAdminsManageChannels(t *testing.T) {
+	bot := newTestBot(t)
+
+	bot.say("UBOB", "CGENERAL", "<@UBOT> enable")
+	posted := bot.slack.posted("CGENERAL")
+	if len(posted) != 1 || !posted[0].Ephemeral || posted[0].User != "UBOB" ||
+		posted[0].Text != "Sorry, only HeyKudos admins can use `enable`." {
+		t.Fatalf("expected an ephemeral refusal to bob, got %+v", posted)
+	}
+	if settings, err := bot.store.ChannelSettings("CGENERAL"); err != nil || settings.Enabled {
+		t.Fatalf("expected #general to stay disabled, got %+v (%v)", settings, err)
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.expectReply("UALICE", "CGENERAL", "Enabled channel <#CGENERAL>")
+
+	bot.slack.reset()
+	for _, cmd := range []string{"disable", "config allowance 1", "audit reciprocity"} {
+		bot.say("UBOB", "CGENERAL", "<@UBOT> "+cmd)
+	}
+	if posted := bot.slack.posted("CGENERAL"); len(posted) != 3 {
+		t.Fatalf("expected bob to be refused 3 times, got %+v", posted)
+	}
+	if settings, err := bot.store.ChannelSettings("CGENERAL"); err != nil || !settings.Enabled || settings.Allowance != 0 {
+		t.Fatalf("expected #general to be unchanged, got %+v (%v)", settings, err)
+	}
+
+	// Everyone can still give kudos and use the other commands
+	bot.say("UBOB", "CGENERAL", "<@UCAROL> :taco:")
+	bot.expectDM("UCAROL", "You just received kudos (:taco:: `1`) from `bob`!")
+	bot.say("UBOB", "CGENERAL", "<@UBOT> leaderboard")
+	if reply := bot.lastReply("CGENERAL"); reply == "Sorry, only HeyKudos admins can use `leaderboard`." {
+		t.Errorf("expected bob to see the leaderboard")
+	}
+}
+
+func TestConfiguredAdmins(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.Admins = []string{"UBOB", "@carol"}
+
+	bot.say("UBOB", "CGENERAL", "<@UBOT> enable")
+	bot.expectReply("UBOB", "CGENERAL", "Enabled channel <#CGENERAL>")
+	bot.say("UCAROL", "GSECRET", "<@UBOT> enable")
+	bot.expectReply("UCAROL", "GSECRET", "Enabled private channel #secret")
+}
+
+func TestSlackAdminStatusIsRechecked(t *testing.T) {
+	bot := newTestBot(t)
+
+	bot.say("UBOB", "CGENERAL", "<@UBOT> enable")
+	bot.expectReply("UBOB", "CGENERAL", "Sorry, only HeyKudos admins can use `enable`.")
+
+	// bob's status is remembered for a while, but picked up once it's checked again
+	bot.slack.setAdmin("UBOB")
+	bot.say("UBOB", "CGENERAL", "<@UBOT> enable")
+	bot.expectReply("UBOB", "CGENERAL", "Sorry, only HeyKudos admins can use `enable`.")
+
+	slackAdmins.Clear()
+	bot.say("UBOB", "CGENERAL", "<@UBOT> enable")
+	bot.expectReply("UBOB", "CGENERAL", "Enabled channel <#CGENERAL>")
+}
+
+func TestAdminGrantAndAdjust(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.EmojiWeights = map[string]int{"star": 2}
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UBOB", "CGENERAL", "<@UCAROL> :star:")
+	bot.slack.reset()
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> admin grant <@UBOB> <@UCAROL> :star: 3 missed during the outage")
+	reply := bot.lastReply("CGENERAL")
+	if !strings.Contains(reply, "`alice` grant: `bob` to `carol` :star: `1` → `4` (`2` → `8` points). Reason: missed during the outage") {
+		t.Errorf("unexpected reply %q", reply)
+	}
+	bot.expectDM("UBOB", "An admin gave `carol` kudos (:star:: `3`) on your behalf. Reason: missed during the outage")
+	bot.expectDM("UCAROL", "An admin gave you kudos (:star:: `3`) from `bob`. Reason: missed during the outage")
+
+	// Grants made by admins don't use up the sender's allowance, only the star bob gave himself did
+	bot.say("UBOB", "CGENERAL", "<@UCAROL> :taco: :taco: :taco:")
+	bot.expectDM("UBOB", "You don't have any kudos left to give today.")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> admin adjust <@UBOB> <@UCAROL> :star: -10 spam")
+	if reply := bot.lastReply("CGENERAL"); !strings.Contains(reply, "adjust: `bob` to `carol` :star: `4` → `0` (`8` → `0` points). Reason: spam") {
+		t.Errorf("unexpected reply %q", reply)
+	}
+	bot.expectDM("UCAROL", "An admin removed kudos (:star:: `4`) you received from `bob`. Reason: spam")
+	bot.say("UALICE", "CGENERAL", "<@UBOT> admin adjust <@UBOB> <@UCAROL> :star: -1 spam")
+	if reply := bot.lastReply("CGENERAL"); reply != "`bob` hasn't given `carol` any :star: kudos, so there's nothing to remove." {
+		t.Errorf("unexpected reply %q", reply)
+	}
+
+	for _, cmd := range []string{
+		"admin grant <@UBOB> <@UCAROL> :star: 2",
+		"admin grant <@UBOB> <@UCAROL> :star: -2 no",
+		"admin adjust <@UBOB> <@UCAROL> :star: lots",
+		"admin grant bob carol :star: 2 no",
+	} {
+		bot.say("UALICE", "CGENERAL", "<@UBOT> "+cmd)
+		if reply := bot.lastReply("CGENERAL"); !strings.HasPrefix(reply, "Usage:") {
+			t.Errorf("expected usage for %q, got %q", cmd, reply)
+		}
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> admin log")
+	reply = bot.lastReply("CGENERAL")
+	lines := strings.Split(reply, "\n")
+	if len(lines) != 3 || lines[0] != "*Admin log* (latest 2)" || !strings.Contains(lines[1], "adjust") ||
+		!strings.Contains(lines[2], "grant") {
+		t.Errorf("expected the adjustment followed by the grant, got %q", reply)
+	}
+
+	var count, points int
+	row := bot.store.(*sqlStore).db.QueryRow("SELECT count, points FROM kudos WHERE emoji = 'star'")
+	if err := row.Scan(&count, &points); err != nil || count != 0 || points != 0 {
+		t.Errorf("expected no stars left, got %v (%v points): %v", count, points, err)
+	}
+}
+
+func TestAdminVoid(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UBOB", "CGENERAL", "<@UALICE> <@UCAROL> :taco: :taco:")
+	bot.slack.reset()
+
+	bot.say("UCAROL", "CGENERAL", "<@UBOT> admin void <https://test.slack.com/archives/CGENERAL/p1600000000000002> spam")
+	if reply := bot.lastReply("CGENERAL"); reply != "Sorry, only HeyKudos admins can use `admin`." {
+		t.Errorf("unexpected reply %q", reply)
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> admin void <https://test.slack.com/archives/CGENERAL/p1600000000000002> spam")
+	reply := bot.lastReply("CGENERAL")
+	if !strings.HasPrefix(reply, "Voided 2 kudos grants:") ||
+		!strings.Contains(reply, "`alice` void: `bob` to `alice` :taco: `1` → `0` (`1` → `0` points). Reason: spam") ||
+		!strings.Contains(reply, "`alice` void: `bob` to `carol` :taco: `1` → `0` (`1` → `0` points). Reason: spam") {
+		t.Errorf("unexpected reply %q", reply)
+	}
+	bot.expectDM("UBOB", "Your kudos to `carol` (:taco:: `1`) were withdrawn because an admin voided them. Reason: spam.")
+	bot.expectDM("UCAROL", "The kudos you received from `bob` (:taco:: `1`) were withdrawn because an admin voided them.")
+
+	// bob got his allowance back
+	bot.say("UBOB", "CGENERAL", "<@UCAROL> :taco: :taco: :taco: :taco: :taco:")
+	bot.expectDM("UBOB", "You don't have any kudos left to give today.")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> admin void <https://test.slack.com/archives/CGENERAL/p1600000000000002> spam")
+	if reply := bot.lastReply("CGENERAL"); reply != "There aren't any kudos to void from that message." {
+		t.Errorf("unexpected reply %q", reply)
+	}
+	bot.say("UALICE", "CGENERAL", "<@UBOT> admin void https://example.com spam")
+	if reply := bot.lastReply("CGENERAL"); reply != "Sorry, https://example.com isn't a link to a message." {
+		t.Errorf("unexpected reply %q", reply)
+	}
+
+	var logged int
+	if err := bot.store.(*sqlStore).db.QueryRow("SELECT COUNT(*) FROM admin_log WHERE action = 'void'").Scan(&logged); err != nil || logged != 2 {
+		t.Errorf("expected 2 voids to be logged, got %v (%v)", logged, err)
+	}
+}
+
+func TestParseMessageLink(t *testing.T) {
+	for link, expected := range map[string][2]string{
+		"https://test.slack.com/archives/CGENERAL/p1600000000000002":                            {"CGENERAL", "1600000000.000002"},
+		"<https://test.slack.com/archives/C01AB/p1600000000123456>":                             {"C01AB", "1600000000.123456"},
+		"<https://test.slack.com/archives/C01AB/p1600000000123456?thread_ts=1600000000.000001>": {"C01AB", "1600000000.123456"},
+		"<https://test.slack.com/archives/C01AB/p1600000000123456|the message>":                 {"C01AB", "1600000000.123456"},
+	} {
+		channel, ts, ok := parseMessageLink(link)
+		if !ok || channel != expected[0] || ts != expected[1] {
+			t.Errorf("expected %v to link to %v, got %v %v %v", link, expected, channel, ts, ok)
+		}
+	}
+	if _, _, ok := parseMessageLink("https://test.slack.com/archives/CGENERAL"); ok {
+		t.Errorf("expected a channel link not to be a message link")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// The allowance policies which can be chosen in the configuration
+const (
+	// PolicyDaily gives everyone the same amount of kudos every day, which reset at midnight in their time zone
+	PolicyDaily = "daily"
+	// PolicyWeekly gives everyone a budget of kudos for the week, which resets at midnight on monday
+	PolicyWeekly = "weekly"
+	// PolicyRolling limits how many kudos can be given in any window of the configured length, each kudos given is
+	// available again once it's that old
+	PolicyRolling = "rolling"
+	// PolicyCarryOver gives everyone kudos every day like PolicyDaily, but unused kudos are saved up to a cap
+	PolicyCarryOver = "carryover"
+)
+
+// Defaults for the allowance settings which aren't set
+const (
+	defaultRollingHours = 24
+	// defaultCarryOverDays is how many days worth of kudos can be saved up if there's no cap
+	defaultCarryOverDays = 3
+)
+
+// AllowancePolicy decides how many kudos users can give and when they can give more. Kudos given in a channel with
+// its own allowance are counted over the same period, but never carry over.
+type AllowancePolicy interface {
+	// Allowance is the user's allowance at the given time. The channel isn't filled in.
+	Allowance(user *User, at time.Time) *Allowance
+	// Amount is how many kudos everyone gets
+	Amount() int
+	// Per describes an amount of kudos under the policy, such as "5 kudos per day"
+	Per(amount int) string
+	// Help explains the policy for the help message
+	Help() string
+	// Period is when the kudos a sender has left can be given, such as "today"
+	Period() string
+	// Resets tells the sender when they can give more kudos once they've run out
+	Resets(allowance *Allowance) string
+}
+
+// newAllowancePolicy creates the allowance policy chosen in the configuration
+func newAllowancePolicy(c *Config) (AllowancePolicy, error) {
+	conf := c.Allowance
+	amount := conf.Amount
+	if amount <= 0 {
+		amount = c.AmountPerDay
+	}
+
+	switch conf.Policy {
+	case "", PolicyDaily:
+		return &dailyPolicy{amount}, nil
+	case PolicyWeekly:
+		if conf.Amount <= 0 {
+			amount = c.AmountPerDay * 7
+		}
+		return &weeklyPolicy{amount}, nil
+	case PolicyRolling:
+		hours := conf.Hours
+		if hours <= 0 {
+			hours = defaultRollingHours
+		}
+		return &rollingPolicy{amount, time.Duration(hours) * time.Hour}, nil
+	case PolicyCarryOver:
+		limit := conf.Cap
+		if limit <= 0 {
+			limit = amount * defaultCarryOverDays
+		}
+		if limit < amount {
+			return nil, fmt.Errorf("the carry over cap of %v is less than the daily amount of %v", limit, amount)
+		}
+		return &carryOverPolicy{amount, limit}, nil
+	default:
+		return nil, fmt.Errorf("unknown allowance policy %q", conf.Policy)
+	}
+}
+
+// dailyPolicy is PolicyDaily
+type dailyPolicy struct {
+	amount int
+}
+
+func (p *dailyPolicy) Allowance(user *User, at time.Time) *Allowance {
+	return &Allowance{
+		Sender: user.Id,
+		Limit:  p.amount,
+		Since:  startOfDay(at, user.Location()),
+		Period: 24 * time.Hour,
+	}
+}
+
+func (p *dailyPolicy) Amount() int {
+	return p.amount
+}
+
+func (p *dailyPolicy) Per(amount int) string {
+	return fmt.Sprintf("%v kudos per day", amount)
+}
+
+func (p *dailyPolicy) Help() string {
+	return fmt.Sprintf("You are limited to %v to send, but you can receive an unlimited amount of kudos!", p.Per(p.amount))
+}
+
+func (p *dailyPolicy) Period() string {
+	return "today"
+}
+
+func (p *dailyPolicy) Resets(allowance *Allowance) string {
+	return fmt.Sprintf("Your kudos reset %v.", formatResetTime(allowance.Since.AddDate(0, 0, 1)))
+}
+
+// weeklyPolicy is PolicyWeekly
+type weeklyPolicy struct {
+	amount int
+}
+
+func (p *weeklyPolicy) Allowance(user *User, at time.Time) *Allowance {
+	return &Allowance{
+		Sender: user.Id,
+		Limit:  p.amount,
+		Since:  startOfWeek(at, user.Location()),
+		Period: 7 * 24 * time.Hour,
+	}
+}
+
+func (p *weeklyPolicy) Amount() int {
+	return p.amount
+}
+
+func (p *weeklyPolicy) Per(amount int) string {
+	return fmt.Sprintf("%v kudos per week", amount)
+}
+
+func (p *weeklyPolicy) Help() string {
+	return fmt.Sprintf("You are limited to %v to send, starting over every monday, but you can receive an unlimited "+
+		"amount of kudos!", p.Per(p.amount))
+}
+
+func (p *weeklyPolicy) Period() string {
+	return "this week"
+}
+
+func (p *weeklyPolicy) Resets(allowance *Allowance) string {
+	return fmt.Sprintf("Your kudos reset %v.", formatResetTime(allowance.Since.AddDate(0, 0, 7)))
+}
+
+// rollingPolicy is PolicyRolling
+type rollingPolicy struct {
+	amount int
+	window time.Duration
+}
+
+func (p *rollingPolicy) Allowance(user *User, at time.Time) *Allowance {
+	return &Allowance{
+		Sender:  user.Id,
+		Limit:   p.amount,
+		Since:   at.Add(-p.window).In(user.Location()),
+		Period:  p.window,
+		Rolling: true,
+	}
+}
+
+func (p *rollingPolicy) Amount() int {
+	return p.amount
+}
+
+func (p *rollingPolicy) Per(amount int) string {
+	return fmt.Sprintf("%v kudos every %v hours", amount, int(p.window.Hours()))
+}
+
+func (p *rollingPolicy) Help() string {
+	return fmt.Sprintf("You are limited to %v to send, and each kudos you send is yours to give again %v hours later. "+
+		"You can receive an unlimited amount of kudos!", p.Per(p.amount), int(p.window.Hours()))
+}
+
+func (p *rollingPolicy) Period() string {
+	return "right now"
+}
+
+func (p *rollingPolicy) Resets(allowance *Allowance) string {
+	return fmt.Sprintf("Each kudos you sent can be given again %v hours after you sent it.", int(p.window.Hours()))
+}
+
+// carryOverPolicy is PolicyCarryOver
+type carryOverPolicy struct {
+	amount int
+	limit  int
+}
+
+func (p *carryOverPolicy) Allowance(user *User, at time.Time) *Allowance {
+	return &Allowance{
+		Sender: user.Id,
+		Limit:  p.amount,
+		Cap:    p.limit,
+		Since:  startOfDay(at, user.Location()),
+		Period: 24 * time.Hour,
+	}
+}
+
+func (p *carryOverPolicy) Amount() int {
+	return p.amount
+}
+
+func (p *carryOverPolicy) Per(amount int) string {
+	return fmt.Sprintf("%v kudos per day", amount)
+}
+
+func (p *carryOverPolicy) Help() string {
+	return fmt.Sprintf("You get %v to send, and any you don't send are saved for later, up to %v kudos. You can "+
+		"receive an unlimited amount of kudos!", p.Per(p.amount), p.limit)
+}
+
+func (p *carryOverPolicy) Period() string {
+	return "today"
+}
+
+func (p *carryOverPolicy) Resets(allowance *Allowance) string {
+	return fmt.Sprintf("You get %v more kudos %v.", allowance.Limit, formatResetTime(allowance.Since.AddDate(0, 0, 1)))
+}
+
+// leftIn tells the sender how many kudos they have left to give in the policy's period. Where is added to say what the
+// kudos are limited to, such as " in this channel".
+func leftIn(left int, policy AllowancePolicy, where string) string {
+	period := policy.Period()
+	if left == 0 {
+		return fmt.Sprintf("You don't have any kudos left to give %v%v.", period, where)
+	}
+	return fmt.Sprintf("You have %v kudos left to give %v%v.", left, period, where)
+}
+
+// startOfWeek returns midnight at the start of the monday of the week of the given time in the location
+func startOfWeek(t time.Time, loc *time.Location) time.Time {
+	day := startOfDay(t, loc)
+	// weeks start on monday
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// formatResetTime writes out when an allowance resets. Slack shows the time in the reader's own time zone, clients
+// which can't fall back to the time in the time zone it was given in.
+func formatResetTime(resets time.Time) string {
+	fallback := resets.Format("Mon Jan 2 at 15:04 MST")
+	return fmt.Sprintf("<!date^%v^{date_short_pretty} at {time}|%v>", resets.Unix(), fallback)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWeeklyAllowance(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.Allowance = AllowanceConfig{Policy: PolicyWeekly, Amount: 10}
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco: :taco: :taco: :taco: :taco:")
+	bot.expectDM("UALICE", "You have 3 kudos left to give this week.")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco: :taco:")
+	bot.expectDM("UALICE", "you tried to give 4 kudos, but you only have 3 kudos left to give this week")
+
+	monday := startOfWeek(time.Now(), time.Local).AddDate(0, 0, 7)
+	bot.expectDM("UALICE", "Your kudos reset "+formatResetTime(monday))
+	if got := bot.received("UBOB"); got != 7 {
+		t.Errorf("expected bob to have 7 kudos, got %v", got)
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> help")
+	if reply := bot.lastReply("CGENERAL"); !strings.Contains(reply, "You are limited to 10 kudos per week to send") {
+		t.Errorf("expected the help to explain the weekly allowance, got %q", reply)
+	}
+}
+
+func TestRollingAllowance(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.Allowance = AllowanceConfig{Policy: PolicyRolling, Amount: 3, Hours: 12}
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco:")
+	bot.expectDM("UALICE", "You don't have any kudos left to give right now.")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	bot.expectDM("UALICE", "You can only give 3 kudos every 12 hours.")
+
+	// Once the kudos are older than the window, they can be given again
+	bot.ageGrants(time.Now().Add(-13 * time.Hour))
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco:")
+	bot.expectDM("UALICE", "You have 1 kudos left to give right now.")
+	if got := bot.received("UBOB"); got != 5 {
+		t.Errorf("expected bob to have 5 kudos, got %v", got)
+	}
+}
+
+func TestRollingAllowanceInOtherTimeZone(t *testing.T) {
+	inLocalZone(t, time.UTC)
+	bot := newTestBot(t)
+	bot.slack.setTz("UALICE", "Asia/Tokyo")
+	BotConfig.Allowance = AllowanceConfig{Policy: PolicyRolling, Amount: 3, Hours: 24}
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco:")
+	bot.expectDM("UALICE", "You don't have any kudos left to give right now.")
+
+	// The kudos are still inside alice's window, even though she's 9 hours ahead of the server
+	bot.ageGrants(time.Now().Add(-20 * time.Hour))
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	bot.expectDM("UALICE", "You can only give 3 kudos every 24 hours.")
+	if got := bot.received("UBOB"); got != 3 {
+		t.Fatalf("expected bob to have 3 kudos, got %v", got)
+	}
+
+	bot.ageGrants(time.Now().Add(-25 * time.Hour))
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	bot.expectDM("UALICE", "You have 2 kudos left to give right now.")
+}
+
+func TestChannelAllowanceInOtherTimeZone(t *testing.T) {
+	inLocalZone(t, time.UTC)
+	bot := newTestBot(t)
+	bot.slack.setTz("UALICE", "America/Chicago")
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UALICE", "CGENERAL", "<@UBOT> config allowance 2")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco:")
+	bot.expectDM("UALICE", "You don't have any kudos left to give today in this channel.")
+
+	// Kudos given just before the day started in Chicago don't count towards today, even though it was already the
+	// same day on the server
+	chicago := mustLoadLocation(t, "America/Chicago")
+	bot.ageGrants(startOfDay(time.Now(), chicago).Add(-time.Hour))
+	bot.slack.reset()
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco:")
+	bot.expectDM("UALICE", "You don't have any kudos left to give today in this channel.")
+	if got := bot.received("UBOB"); got != 4 {
+		t.Errorf("expected bob to have 4 kudos, got %v", got)
+	}
+}
+
+func TestCarryOverAllowance(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.Allowance = AllowanceConfig{Policy: PolicyCarryOver, Amount: 2, Cap: 5}
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	db := bot.store.(*sqlStore).db
+	daysAgo := func(days int) {
+		t.Helper()
+		day := rateDay(time.Now().AddDate(0, 0, -days), time.Local)
+		if _, err := db.Exec("UPDATE rate SET time = ?", day); err != nil {
+			t.Fatalf("failed to move the allowance back: %v", err)
+		}
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	bot.expectDM("UALICE", "You have 1 kudos left to give today.")
+
+	// The kudos which weren't given yesterday are added to today's
+	daysAgo(1)
+	bot.slack.reset()
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco: :taco:")
+	bot.expectDM("UALICE", "you tried to give 4 kudos, but you only have 3 kudos left to give today")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	bot.expectDM("UALICE", "You have 2 kudos left to give today.")
+
+	// No more than the cap can be saved up
+	daysAgo(4)
+	bot.slack.reset()
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco: :taco: :taco: :taco:")
+	bot.expectDM("UALICE", "you tried to give 6 kudos, but you only have 5 kudos left to give today")
+	bot.expectDM("UALICE", "You get 2 more kudos ")
+}
+
+// The allowance is kept by date, which some drivers read back in the server's time zone. A server on either side of
+// UTC mustn't see it as an earlier period and reset it on every message.
+func TestAllowancesInServerTimeZones(t *testing.T) {
+	for _, name := range []string{"America/New_York", "Europe/London", "Asia/Tokyo"} {
+		t.Run(name, func(t *testing.T) {
+			inLocalZone(t, mustLoadLocation(t, name))
+			t.Run("daily", TestRateLimit)
+			t.Run("weekly", TestWeeklyAllowance)
+			t.Run("carry over", TestCarryOverAllowance)
+			t.Run("failed kudos", TestFailedKudosDontUseAllowance)
+			t.Run("concurrent", TestConcurrentMessagesCantOverspend)
+			t.Run("revoked", TestDeletedMessageOnlyRefundsCurrentAllowance)
+		})
+	}
+}
+
+func TestAllowancePolicyConfig(t *testing.T) {
+	for _, conf := range []AllowanceConfig{
+		{Policy: "monthly"},
+		{Policy: PolicyCarryOver, Amount: 5, Cap: 3},
+	} {
+		if _, err := newAllowancePolicy(&Config{AmountPerDay: 5, Allowance: conf}); err == nil {
+			t.Errorf("expected %+v to be invalid", conf)
+		}
+	}
+
+	policy, err := newAllowancePolicy(&Config{AmountPerDay: 5, Allowance: AllowanceConfig{Policy: PolicyWeekly}})
+	if err != nil || policy.Amount() != 35 {
+		t.Errorf("expected a weekly allowance of a week's worth of amountPerDay, got %+v (%v)", policy, err)
+	}
+}
+
+func TestRecipientCaps(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.AmountPerDay = 10
+	BotConfig.RecipientCaps = RecipientCapsConfig{Day: 3}
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco:")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> <@UCAROL> :taco: :star:")
+	resets := formatResetTime(startOfDay(time.Now(), time.Local).AddDate(0, 0, 1))
+	bot.expectDM("UALICE", "Sorry, you can only give `bob` 3 kudos per day, but you've already given them 3 today and "+
+		"tried to give them 1 more. None of your kudos were sent. Your kudos for `bob` reset "+resets+".")
+	if got := bot.received("UCAROL"); got != 0 {
+		t.Errorf("expected carol not to get any kudos from the blocked message, got %v", got)
+	}
+
+	// Other recipients aren't affected
+	bot.say("UALICE", "CGENERAL", "<@UCAROL> :taco: :taco: :taco:")
+	if got := bot.received("UCAROL"); got != 3 {
+		t.Errorf("expected carol to have 3 kudos, got %v", got)
+	}
+}
+
+func TestRecipientCapsInOtherTimeZone(t *testing.T) {
+	inLocalZone(t, time.UTC)
+	bot := newTestBot(t)
+	bot.slack.setTz("UALICE", "America/Chicago")
+	BotConfig.AmountPerDay = 10
+	BotConfig.RecipientCaps = RecipientCapsConfig{Day: 3}
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco:")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	bot.expectDM("UALICE", "Sorry, you can only give `bob` 3 kudos per day")
+
+	// Kudos given just before the day started in Chicago don't count towards today's cap, even though it was already
+	// the same day on the server
+	chicago := mustLoadLocation(t, "America/Chicago")
+	bot.ageGrants(startOfDay(time.Now(), chicago).Add(-time.Hour))
+	bot.slack.reset()
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco:")
+	if got := bot.received("UBOB"); got != 6 {
+		t.Errorf("expected bob to have 6 kudos, got %v", got)
+	}
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	bot.expectDM("UALICE", "Sorry, you can only give `bob` 3 kudos per day")
+	if got := bot.received("UBOB"); got != 6 {
+		t.Errorf("expected the cap to stop bob getting more than 6 kudos, got %v", got)
+	}
+}
+
+func TestRecipientCapsCountEachPeriod(t *testing.T) {
+	bot := newTestBot(t)
+	alice, _ := GetUser("UALICE", bot.slack, bot.store)
+	bob, _ := GetUser("UBOB", bot.slack, bot.store)
+
+	week := &RecipientCap{Period: "week", Since: time.Now().Add(-72 * time.Hour), Limit: 4}
+	allowance := &Allowance{Sender: alice.Id, Limit: 100, RecipientCaps: []*RecipientCap{week}}
+	grant := func(days int, points int64) error {
+		_, err := bot.store.GiveGrants(allowance, []*Grant{{Sender: alice.Id, Recipient: bob.Id, Emoji: "taco",
+			Count: points, Points: points, CreatedAt: time.Now().AddDate(0, 0, -days)}})
+		return err
+	}
+
+	// Kudos from before the period don't count towards it
+	if err := grant(5, 4); err != nil {
+		t.Fatalf("expected the first kudos to be given, got %v", err)
+	}
+	if err := grant(1, 3); err != nil {
+		t.Fatalf("expected kudos within the cap to be given, got %v", err)
+	}
+	err := grant(0, 2)
+	if capped, ok := err.(*RecipientCapError); !ok || capped.Cap != week || capped.Used != 3 || capped.Requested != 2 {
+		t.Errorf("expected the weekly cap to stop the kudos, got %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Thresholds for the reciprocity audit. They're in points, like the leaderboards.
+const (
+	// reciprocalMinPoints is how many points both users of a pair have to have given each other to be reported
+	reciprocalMinPoints = 5
+	// reciprocalMinRatio is how close what both users of a pair gave each other has to be, as the smaller amount over
+	// the larger one
+	reciprocalMinRatio = 0.5
+	// loopMinPoints is how many points each user in a loop has to have given the next one for it to count
+	loopMinPoints = 3
+	// maxLoopLength is the most users a loop is followed through
+	maxLoopLength = 5
+	// maxLoopSteps is how many gifts the search for loops follows at most. The number of possible loops grows quickly
+	// when many users give each other kudos, so the search gives up rather than holding up the reply.
+	maxLoopSteps = 100000
+	// concentratedMinPoints is how many points a user has to have given in total for their giving to be checked
+	concentratedMinPoints = 10
+	// concentratedMinShare is the share of a user's points going to a single recipient which gets them reported
+	concentratedMinShare = 0.6
+	// maxFindings is how many findings of each kind are listed
+	maxFindings = 10
+)
+
+// PairTotal is how many points worth of kudos one user has given another in total
+type PairTotal struct {
+	Sender        int64
+	SenderName    string
+	Recipient     int64
+	RecipientName string
+	Points        int
+}
+
+// ReciprocalPair is a pair of users who have given each other a similar amount of kudos
+type ReciprocalPair struct {
+	First  *PairTotal
+	Second *PairTotal
+}
+
+// KudosLoop is a ring of three or more users, each of which has given the next one kudos, with the last one giving the
+// first one kudos
+type KudosLoop struct {
+	Edges []*PairTotal
+}
+
+// ConcentratedGiver is a user who has given most of their kudos to a single recipient
+type ConcentratedGiver struct {
+	Top   *PairTotal
+	Total int
+}
+
+// AuditCommand handles `@heykudos audit`. Only `audit reciprocity` exists so far, which looks for users trading kudos
+// with each other rather than recognizing the whole team. The report is only shown to the user who asked for it.
+func AuditCommand(req *Request, api Chat, store Store) {
+	fields := strings.Fields(strings.TrimPrefix(req.Text, CommandText))
+	if len(fields) != 2 || strings.ToLower(fields[1]) != "reciprocity" {
+		replyConfig(req, api, "Usage: `audit reciprocity`")
+		return
+	}
+
+	totals, err := store.PairTotals()
+	if err != nil {
+		log.Printf("Error while querying kudos totals: %v\n", err)
+		replyConfig(req, api, "Sorry, something went wrong while auditing the kudos.")
+		return
+	}
+
+	loops, complete := findLoops(totals)
+	replyConfig(req, api, formatAudit(findReciprocalPairs(totals), loops, complete, findConcentratedGivers(totals)))
+}
+
+// findReciprocalPairs finds the pairs of users who have both given each other at least reciprocalMinPoints, with
+// neither giving much more than the other. The pairs which traded the most come first.
+func findReciprocalPairs(totals []*PairTotal) []*ReciprocalPair {
+	type key struct {
+		sender    int64
+		recipient int64
+	}
+	given := make(map[key]*PairTotal, len(totals))
+	for _, total := range totals {
+		given[key{total.Sender, total.Recipient}] = total
+	}
+
+	pairs := make([]*ReciprocalPair, 0)
+	for _, first := range totals {
+		// Every pair is seen from both sides, it's only checked from the side of the lower id
+		if first.Sender >= first.Recipient {
+			continue
+		}
+		second, ok := given[key{first.Recipient, first.Sender}]
+		if !ok || first.Points < reciprocalMinPoints || second.Points < reciprocalMinPoints {
+			continue
+		}
+
+		low, high := first.Points, second.Points
+		if low > high {
+			low, high = high, low
+		}
+		if float64(low)/float64(high) < reciprocalMinRatio {
+			continue
+		}
+
+		// The user who gave more is listed first
+		if second.Points > first.Points {
+			first, second = second, first
+		}
+		pairs = append(pairs, &ReciprocalPair{first, second})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool {
+		a := pairs[i].First.Points + pairs[i].Second.Points
+		b := pairs[j].First.Points + pairs[j].Second.Points
+		if a != b {
+			return a > b
+		}
+		return pairs[i].First.SenderName < pairs[j].First.SenderName
+	})
+	return pairs
+}
+
+// findLoops finds rings of three up to maxLoopLength users where each gave the next at least loopMinPoints. Every loop
+// is found once, starting from its user with the lowest id. The loops where the least given along the way is the
+// highest come first. Returns false if the search was stopped after maxLoopSteps, in which case there may be more.
+func findLoops(totals []*PairTotal) ([]*KudosLoop, bool) {
+	edges := make(map[int64][]*PairTotal)
+	for _, total := range totals {
+		if total.Points >= loopMinPoints && total.Sender != total.Recipient {
+			edges[total.Sender] = append(edges[total.Sender], total)
+		}
+	}
+
+	loops := make([]*KudosLoop, 0)
+	steps, truncated := 0, false
+	var follow func(start int64, path []*PairTotal, visited map[int64]bool)
+	follow = func(start int64, path []*PairTotal, visited map[int64]bool) {
+		last := path[len(path)-1].Recipient
+		for _, edge := range edges[last] {
+			if steps == maxLoopSteps {
+				truncated = true
+				return
+			}
+			steps++
+
+			switch {
+			case edge.Recipient == start:
+				if len(path) >= 2 {
+					loop := append(append([]*PairTotal{}, path...), edge)
+					loops = append(loops, &KudosLoop{loop})
+				}
+			case edge.Recipient > start && !visited[edge.Recipient] && len(path) < maxLoopLength-1:
+				visited[edge.Recipient] = true
+				follow(start, append(path, edge), visited)
+				delete(visited, edge.Recipient)
+			}
+		}
+	}
+
+	starts := make([]int64, 0, len(edges))
+	for start := range edges {
+		starts = append(starts, start)
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+
+	for _, start := range starts {
+		for _, edge := range edges[start] {
+			if edge.Recipient > start {
+				follow(start, []*PairTotal{edge}, map[int64]bool{edge.Recipient: true})
+			}
+		}
+	}
+
+	sort.SliceStable(loops, func(i, j int) bool {
+		return loops[i].weakest() > loops[j].weakest()
+	})
+	return loops, !truncated
+}
+
+// weakest is the least given by any user in the loop to the next
+func (l *KudosLoop) weakest() int {
+	weakest := l.Edges[0].Points
+	for _, edge := range l.Edges[1:] {
+		if edge.Points < weakest {
+			weakest = edge.Points
+		}
+	}
+	return weakest
+}
+
+// findConcentratedGivers finds the users who have given at least concentratedMinPoints, with at least
+// concentratedMinShare of them going to a single recipient. The most concentrated givers come first.
+func findConcentratedGivers(totals []*PairTotal) []*ConcentratedGiver {
+	givers := make(map[int64]*ConcentratedGiver)
+	order := make([]int64, 0)
+	for _, total := range totals {
+		giver, ok := givers[total.Sender]
+		if !ok {
+			giver = &ConcentratedGiver{Top: total}
+			givers[total.Sender] = giver
+			order = append(order, total.Sender)
+		}
+		giver.Total += total.Points
+		if total.Points > giver.Top.Points {
+			giver.Top = total
+		}
+	}
+
+	concentrated := make([]*ConcentratedGiver, 0)
+	for _, sender := range order {
+		giver := givers[sender]
+		if giver.Total >= concentratedMinPoints && giver.share() >= concentratedMinShare {
+			concentrated = append(concentrated, giver)
+		}
+	}
+
+	sort.Slice(concentrated, func(i, j int) bool {
+		if concentrated[i].share() != concentrated[j].share() {
+			return concentrated[i].share() > concentrated[j].share()
+		}
+		return concentrated[i].Top.SenderName < concentrated[j].Top.SenderName
+	})
+	return concentrated
+}
+
+// share is how much of what the user gave went to their top recipient
+func (c *ConcentratedGiver) share() float64 {
+	return float64(c.Top.Points) / float64(c.Total)
+}
+
+// formatAudit writes out the findings of the reciprocity audit, with the numbers which got each of them reported
+func formatAudit(pairs []*ReciprocalPair, loops []*KudosLoop, loopsComplete bool, givers []*ConcentratedGiver) string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("%v Reciprocity Audit (all time points)\n", TeamName))
+
+	sb.WriteString(fmt.Sprintf("*Reciprocal pairs* (both gave at least %v, neither gave more than twice the other)\n",
+		reciprocalMinPoints))
+	if len(pairs) == 0 {
+		sb.WriteString(">None found\n")
+	}
+	for i, pair := range pairs {
+		if i == maxFindings {
+			sb.WriteString(fmt.Sprintf(">...and %v more\n", len(pairs)-maxFindings))
+			break
+		}
+		sb.WriteString(fmt.Sprintf(">`%v` gave `%v` `%v`, `%v` gave `%v` `%v`\n", pair.First.SenderName,
+			pair.First.RecipientName, pair.First.Points, pair.Second.SenderName, pair.Second.RecipientName,
+			pair.Second.Points))
+	}
+
+	sb.WriteString(fmt.Sprintf("*Closed loops* (each gave the next at least %v)\n", loopMinPoints))
+	if len(loops) == 0 {
+		sb.WriteString(">None found\n")
+	}
+	for i, loop := range loops {
+		if i == maxFindings {
+			sb.WriteString(fmt.Sprintf(">...and %v more\n", len(loops)-maxFindings))
+			break
+		}
+		sb.WriteString(">")
+		for _, edge := range loop.Edges {
+			sb.WriteString(fmt.Sprintf("`%v` -(`%v`)-> ", edge.SenderName, edge.Points))
+		}
+		sb.WriteString(fmt.Sprintf("`%v`\n", loop.Edges[0].SenderName))
+	}
+	if !loopsComplete {
+		sb.WriteString(fmt.Sprintf(">The search stopped after following %v gifts, there may be more loops\n",
+			maxLoopSteps))
+	}
+
+	sb.WriteString(fmt.Sprintf("*Concentrated giving* (at least %v%% of %v or more to one person)\n",
+		int(concentratedMinShare*100), concentratedMinPoints))
+	if len(givers) == 0 {
+		sb.WriteString(">None found")
+	}
+	for i, giver := range givers {
+		if i == maxFindings {
+			sb.WriteString(fmt.Sprintf("\n>...and %v more", len(givers)-maxFindings))
+			break
+		}
+		if i != 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(fmt.Sprintf(">`%v` gave `%v` of `%v` (%v%%) to `%v`", giver.Top.SenderName, giver.Top.Points,
+			giver.Total, int(giver.share()*100), giver.Top.RecipientName))
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// pair builds the total for the sender giving the recipient points, using the ids as names
+func pair(sender int64, recipient int64, points int) *PairTotal {
+	names := map[int64]string{1: "alice", 2: "bob", 3: "carol", 4: "dave", 5: "erin", 6: "frank"}
+	return &PairTotal{
+		Sender:        sender,
+		SenderName:    names[sender],
+		Recipient:     recipient,
+		RecipientName: names[recipient],
+		Points:        points,
+	}
+}
+
+func TestFindReciprocalPairs(t *testing.T) {
+	totals := []*PairTotal{
+		pair(1, 2, 6), pair(2, 1, 8), // reciprocal
+		pair(1, 3, 20), pair(3, 1, 5), // too one sided
+		pair(2, 3, 4), pair(3, 2, 4), // too few points
+		pair(4, 5, 10), pair(5, 4, 10), // reciprocal and traded the most
+	}
+
+	pairs := findReciprocalPairs(totals)
+	if len(pairs) != 2 {
+		t.Fatalf("expected 2 reciprocal pairs, got %v", len(pairs))
+	}
+	if pairs[0].First.SenderName != "dave" || pairs[0].Second.SenderName != "erin" {
+		t.Errorf("expected dave and erin first, got %+v %+v", pairs[0].First, pairs[0].Second)
+	}
+	// The user who gave more is listed first
+	if pairs[1].First.SenderName != "bob" || pairs[1].First.Points != 8 || pairs[1].Second.Points != 6 {
+		t.Errorf("expected bob to be listed first with 8, got %+v %+v", pairs[1].First, pairs[1].Second)
+	}
+}
+
+func TestFindLoops(t *testing.T) {
+	totals := []*PairTotal{
+		pair(1, 2, 3), pair(2, 3, 4), pair(3, 1, 5), // a loop of three
+		pair(4, 5, 9), pair(5, 6, 9), pair(6, 4, 2), // too little given back to close it
+		pair(2, 1, 3),                // only two people, which is a reciprocal pair rather than a loop
+		pair(3, 4, 6), pair(4, 1, 6), // alice, bob, carol and dave loop too
+	}
+
+	loops, complete := findLoops(totals)
+	if len(loops) != 2 || !complete {
+		t.Fatalf("expected all 2 loops to be found, got %v (complete: %v)", len(loops), complete)
+	}
+	// Both loops start from alice and their weakest links are 3
+	for _, loop := range loops {
+		if loop.Edges[0].Sender != 1 || loop.weakest() != 3 {
+			t.Errorf("expected the loop to start from alice with 3 as the least given, got %+v", loop.Edges)
+		}
+	}
+	if len(loops[0].Edges) != 3 || len(loops[1].Edges) != 4 {
+		t.Errorf("expected loops of 3 and 4 people, got %v and %v", len(loops[0].Edges), len(loops[1].Edges))
+	}
+}
+
+func TestFindLoopsStopsSearching(t *testing.T) {
+	// Everyone giving everyone else kudos makes for far too many loops to follow them all
+	totals := make([]*PairTotal, 0)
+	for sender := int64(1); sender <= 30; sender++ {
+		for recipient := int64(1); recipient <= 30; recipient++ {
+			if sender != recipient {
+				totals = append(totals, &PairTotal{Sender: sender, Recipient: recipient, Points: loopMinPoints})
+			}
+		}
+	}
+
+	loops, complete := findLoops(totals)
+	if complete || len(loops) == 0 {
+		t.Fatalf("expected the search to stop early with some loops found, got %v (complete: %v)", len(loops),
+			complete)
+	}
+	report := formatAudit(nil, loops, complete, nil)
+	if !strings.Contains(report, ">...and ") || !strings.Contains(report, "there may be more loops") {
+		t.Errorf("expected the report to say the search stopped early, got %q", report)
+	}
+}
+
+func TestFindConcentratedGivers(t *testing.T) {
+	totals := []*PairTotal{
+		pair(1, 2, 9), pair(1, 3, 1), // 90% to bob
+		pair(2, 1, 5), pair(2, 3, 5), // split evenly
+		pair(3, 1, 6),                 // all to alice, but too few points to say
+		pair(4, 5, 14), pair(4, 6, 6), // 70% to erin
+	}
+
+	givers := findConcentratedGivers(totals)
+	if len(givers) != 2 {
+		t.Fatalf("expected 2 concentrated givers, got %v", len(givers))
+	}
+	if givers[0].Top.SenderName != "alice" || givers[0].Top.Points != 9 || givers[0].Total != 10 {
+		t.Errorf("expected alice to have given 9 of 10 to bob, got %+v of %v", givers[0].Top, givers[0].Total)
+	}
+	if givers[1].Top.SenderName != "dave" || givers[1].Top.RecipientName != "erin" || givers[1].Total != 20 {
+		t.Errorf("expected dave to have given most to erin, got %+v of %v", givers[1].Top, givers[1].Total)
+	}
+}
+
+func TestFormatAuditListsMostFindings(t *testing.T) {
+	givers := make([]*ConcentratedGiver, 0)
+	for i := 0; i < maxFindings+2; i++ {
+		givers = append(givers, &ConcentratedGiver{Top: pair(1, 2, 10), Total: 10})
+	}
+
+	report := formatAudit(nil, nil, true, givers)
+	lines := strings.Split(report, "\n")
+	if header := lines[1]; header != "*Reciprocal pairs* (both gave at least 5, neither gave more than twice the other)" {
+		t.Errorf("expected the header to describe reciprocal pairs, got %q", header)
+	}
+	if last := lines[len(lines)-1]; last != ">...and 2 more" {
+		t.Errorf("expected the last line to count the givers left out, got %q", last)
+	}
+	if previous := lines[len(lines)-2]; previous != ">`alice` gave `10` of `10` (100%) to `bob`" {
+		t.Errorf("expected the last giver listed on its own line, got %q", previous)
+	}
+}
+
+func TestAuditReciprocity(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.AmountPerDay = 20
+	BotConfig.Admins = []string{"carol"}
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco: :taco: :taco: :taco:")
+	bot.say("UBOB", "CGENERAL", "<@UALICE> :taco: :taco: :taco: :taco: :taco:")
+	bot.say("UBOB", "CGENERAL", "<@UCAROL> :taco: :taco: :taco:")
+	bot.say("UCAROL", "CGENERAL", "<@UALICE> :taco: :taco: :taco:")
+	bot.say("UALICE", "CGENERAL", "<@UCAROL> :star:")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :star: :star: :star: :star:")
+	bot.slack.reset()
+
+	bot.say("UCAROL", "CGENERAL", "<@UBOT> audit reciprocity")
+	posted := bot.slack.posted("CGENERAL")
+	if len(posted) != 1 || !posted[0].Ephemeral || posted[0].User != "UCAROL" {
+		t.Fatalf("expected a single ephemeral reply to carol, got %+v", posted)
+	}
+
+	report := posted[0].Text
+	for _, expected := range []string{
+		"`alice` gave `bob` `10`, `bob` gave `alice` `5`",
+		"`alice` -(`10`)-> `bob` -(`3`)-> `carol` -(`3`)-> `alice`",
+		"`alice` gave `10` of `11` (90%) to `bob`",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("expected the report to contain %q, got %q", expected, report)
+		}
+	}
+	// bob gave 5 of 8 to alice, but that's below the points needed to be checked
+	if strings.Contains(report, "`bob` gave `5` of `8`") {
+		t.Errorf("expected bob's giving not to be reported, got %q", report)
+	}
+
+	bot.say("UCAROL", "CGENERAL", "<@UBOT> audit")
+	if reply := bot.lastReply("CGENERAL"); reply != "Usage: `audit reciprocity`" {
+		t.Errorf("unexpected reply %q", reply)
+	}
+}
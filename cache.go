@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cache is a map which is safe to use from the handler goroutines. Entries can expire after a time to live, after
+// which they're treated as missing and removed the next time they're looked up. Hits and misses are counted so it's
+// possible to tell how well the cache is doing.
+type cache struct {
+	name    string
+	ttl     time.Duration
+	mutex   sync.RWMutex
+	entries map[string]cacheEntry
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// expired determines if the entry has outlived its time to live. Entries without an expiry time never expire.
+func (e cacheEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// cacheStats is a snapshot of how a cache has been used
+type cacheStats struct {
+	Size      int
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+func (s cacheStats) String() string {
+	return fmt.Sprintf("%v entries, %v hits, %v misses, %v expired", s.Size, s.Hits, s.Misses, s.Evictions)
+}
+
+// caches holds every cache which has been created, so their stats can be logged without having to list them
+var caches struct {
+	sync.Mutex
+	all []*cache
+}
+
+// newCache creates an empty cache. Entries expire after the ttl, or never if it's 0.
+func newCache(name string, ttl time.Duration) *cache {
+	c := &cache{
+		name:    name,
+		ttl:     ttl,
+		entries: make(map[string]cacheEntry),
+	}
+
+	caches.Lock()
+	caches.all = append(caches.all, c)
+	caches.Unlock()
+	return c
+}
+
+// allCaches returns every cache which has been created, in the order they were created
+func allCaches() []*cache {
+	caches.Lock()
+	defer caches.Unlock()
+	return append([]*cache(nil), caches.all...)
+}
+
+// Get returns the value stored for the key, if there is one which hasn't expired
+func (c *cache) Get(key string) (interface{}, bool) {
+	c.mutex.RLock()
+	entry, ok := c.entries[key]
+	c.mutex.RUnlock()
+
+	if ok && entry.expired(time.Now()) {
+		c.mutex.Lock()
+		// It may have been replaced since it was read
+		if current, ok := c.entries[key]; ok && current.expired(time.Now()) {
+			delete(c.entries, key)
+			atomic.AddUint64(&c.evictions, 1)
+		}
+		c.mutex.Unlock()
+		ok = false
+	}
+
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&c.hits, 1)
+	return entry.value, true
+}
+
+// Set stores the value for the key, using the cache's time to live
+func (c *cache) Set(key string, value interface{}) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL stores the value for the key, expiring after the ttl instead of the cache's own time to live. A ttl of 0
+// means the entry never expires.
+func (c *cache) SetWithTTL(key string, value interface{}, ttl time.Duration) {
+	entry := cacheEntry{value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+
+	c.mutex.Lock()
+	c.entries[key] = entry
+	c.mutex.Unlock()
+}
+
+// Delete removes the key from the cache
+func (c *cache) Delete(key string) {
+	c.mutex.Lock()
+	delete(c.entries, key)
+	c.mutex.Unlock()
+}
+
+// DeleteFunc removes every entry the function returns true for
+func (c *cache) DeleteFunc(f func(key string, value interface{}) bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, entry := range c.entries {
+		if f(key, entry.value) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Range calls the function for every entry which hasn't expired, stopping early if it returns false. The cache is
+// locked for reading while this runs, so the function mustn't change the cache.
+func (c *cache) Range(f func(key string, value interface{}) bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	now := time.Now()
+	for key, entry := range c.entries {
+		if entry.expired(now) {
+			continue
+		}
+		if !f(key, entry.value) {
+			return
+		}
+	}
+}
+
+// Clear removes everything from the cache
+func (c *cache) Clear() {
+	c.mutex.Lock()
+	c.entries = make(map[string]cacheEntry)
+	c.mutex.Unlock()
+}
+
+// Stats returns how many entries the cache holds and how it's been used so far
+func (c *cache) Stats() cacheStats {
+	c.mutex.RLock()
+	size := len(c.entries)
+	c.mutex.RUnlock()
+
+	return cacheStats{
+		Size:      size,
+		Hits:      atomic.LoadUint64(&c.hits),
+		Misses:    atomic.LoadUint64(&c.misses),
+		Evictions: atomic.LoadUint64(&c.evictions),
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	c := newCache("test", 0)
+	c.Set("taco", "taco")
+	c.SetWithTTL("brief", "brief", time.Millisecond)
+
+	if value, ok := c.Get("taco"); !ok || value != "taco" {
+		t.Errorf("expected taco to be cached, got %v (%v)", value, ok)
+	}
+	if _, ok := c.Get("missing"); ok {
+		t.Errorf("expected missing not to be cached")
+	}
+
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.Get("brief"); ok {
+		t.Errorf("expected brief to have expired")
+	}
+
+	stats := c.Stats()
+	if stats.Size != 1 || stats.Hits != 1 || stats.Misses != 2 || stats.Evictions != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	c.DeleteFunc(func(key string, value interface{}) bool {
+		return value == "taco"
+	})
+	if _, ok := c.Get("taco"); ok {
+		t.Errorf("expected taco to be deleted")
+	}
+}
+
+func TestCacheConcurrentAccess(t *testing.T) {
+	c := newCache("test", time.Millisecond)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				key := fmt.Sprintf("key%v", j%10)
+				c.Set(key, i)
+				c.Get(key)
+				c.Range(func(key string, value interface{}) bool {
+					return true
+				})
+				if j%50 == 0 {
+					c.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if stats := c.Stats(); stats.Hits+stats.Misses != 8*200 {
+		t.Errorf("expected every lookup to be counted, got %+v", stats)
+	}
+}
+
+func TestAllCachesIncludesPackageCaches(t *testing.T) {
+	registered := make(map[*cache]bool)
+	for _, c := range allCaches() {
+		registered[c] = true
+	}
+	for _, c := range []*cache{emojiCache, unknownEmojis, channelSettings, slackAdmins, checkedUserTzs, locations} {
+		if !registered[c] {
+			t.Errorf("expected the %v cache to be registered", c.name)
+		}
+	}
+}
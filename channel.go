@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ChannelSettings are the per channel settings, stored alongside whether the channel is enabled. The zero values mean
+// the channel uses the global defaults.
+type ChannelSettings struct {
+	Name    string
+	Enabled bool
+	// Allowance is how many kudos each user can give in this channel in each period of the allowance policy. Kudos
+	// given in a channel with its own allowance don't count towards the global allowance. 0 means the global allowance
+	// is used.
+	Allowance int
+	// Emojis are the only emojis which can be given as kudos in this channel. If empty, any emoji can be given.
+	Emojis []string
+	// Announce posts every kudos given in this channel publicly in the channel
+	Announce bool
+}
+
+// allowsEmoji determines if the emoji can be given as kudos in the channel
+func (c *ChannelSettings) allowsEmoji(emoji string) bool {
+	if len(c.Emojis) == 0 {
+		return true
+	}
+	for _, allowed := range c.Emojis {
+		if allowed == emoji {
+			return true
+		}
+	}
+	return false
+}
+
+// channelSettingsTtl is how long channel settings are cached before they're read from the database again, so changes
+// made by another instance of the bot are picked up eventually
+const channelSettingsTtl = 10 * time.Minute
+
+// channelSettings caches the settings of every channel which has been looked up. Cached settings are never modified,
+// changing a channel's settings replaces them instead.
+var channelSettings = newCache("channel settings", channelSettingsTtl)
+
+// getChannelSettings returns the settings of the channel, loading them from the store the first time. Returns nil if
+// the settings couldn't be loaded.
+func getChannelSettings(channel string, store Store) *ChannelSettings {
+	if settings, ok := channelSettings.Get(channel); ok {
+		return settings.(*ChannelSettings)
+	}
+
+	settings, err := store.ChannelSettings(channel)
+	if err != nil {
+		log.Printf("Error while querying enabled_channels: %v\n", err)
+		return nil
+	}
+
+	channelSettings.Set(channel, settings)
+	return settings
+}
+
+// checkChannelEnabled determines if a particular channel is enabled (turned on with @heykudos enable). The state is
+// stored in the database, but it's cached along with the rest of the channel's settings after the initial read.
+func checkChannelEnabled(channelName string, store Store) bool {
+	settings := getChannelSettings(channelName, store)
+	return settings != nil && settings.Enabled
+}
+
+// startOfDay returns midnight at the start of the day of the given time in the location
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	year, month, day := t.In(loc).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
+// ConfigureChannel handles `@heykudos config`. Without any arguments the channel's current settings are shown,
+// otherwise one of them is changed:
+//
+//	@heykudos config allowance 3
+//	@heykudos config allowance default
+//	@heykudos config emojis :taco: :star:
+//	@heykudos config emojis any
+//	@heykudos config announce on
+func ConfigureChannel(req *Request, api Chat, store Store) {
+	fields := strings.Fields(strings.TrimPrefix(req.Text, CommandText))
+	args := fields[1:]
+
+	current := getChannelSettings(req.Channel, store)
+	if current == nil {
+		replyConfig(req, api, "Sorry, something went wrong while looking up this channel's settings.")
+		return
+	}
+
+	if len(args) == 0 {
+		replyConfig(req, api, describeSettings(current))
+		return
+	}
+
+	conversation, err := api.GetConversationInfo(req.Channel, true)
+	if err != nil {
+		log.Printf("Failed to get channel info for %v\n: %v", req.Channel, err)
+		return
+	}
+	if conversation.IsIM || conversation.IsMpIM {
+		replyConfig(req, api, "Sorry, you're only allowed to configure normal channels")
+		return
+	}
+
+	settings := *current
+	switch strings.ToLower(args[0]) {
+	case "allowance":
+		if len(args) != 2 {
+			replyConfig(req, api, "Usage: `config allowance <number>` or `config allowance default`")
+			return
+		}
+		if strings.ToLower(args[1]) == "default" {
+			settings.Allowance = 0
+			break
+		}
+		allowance, err := strconv.Atoi(args[1])
+		if err != nil || allowance < 1 {
+			replyConfig(req, api, fmt.Sprintf("Sorry, `%v` isn't a valid allowance, it has to be a number above 0.", args[1]))
+			return
+		}
+		settings.Allowance = allowance
+	case "emojis":
+		if len(args) == 2 && strings.ToLower(args[1]) == "any" {
+			settings.Emojis = nil
+			break
+		}
+		emojis := unique(flatten(emojiPattern.FindAllStringSubmatch(strings.Join(args[1:], " "), -1), 1))
+		valid := make([]string, 0, len(emojis))
+		for _, emoji := range emojis {
+			if emoji == "" {
+				continue
+			}
+			canonical, ok := canonicalEmoji(emoji)
+			if !ok {
+				replyConfig(req, api, fmt.Sprintf("Sorry, `:%v:` isn't an emoji I know.", emoji))
+				return
+			}
+			valid = append(valid, canonical)
+		}
+		valid = unique(valid)
+		if len(valid) == 0 {
+			replyConfig(req, api, "Usage: `config emojis :emoji: ...` or `config emojis any`")
+			return
+		}
+		settings.Emojis = valid
+	case "announce":
+		if len(args) != 2 {
+			replyConfig(req, api, "Usage: `config announce on` or `config announce off`")
+			return
+		}
+		switch strings.ToLower(args[1]) {
+		case "on", "yes", "true":
+			settings.Announce = true
+		case "off", "no", "false":
+			settings.Announce = false
+		default:
+			replyConfig(req, api, "Usage: `config announce on` or `config announce off`")
+			return
+		}
+	default:
+		replyConfig(req, api, "I can only configure `allowance`, `emojis` and `announce`.")
+		return
+	}
+
+	log.Printf("Changing settings of channel %v\n", req.Channel)
+	err = store.SaveChannelSettings(&settings)
+	if err != nil {
+		log.Printf("Failed to save settings of channel %v: %v\n", req.Channel, err)
+		replyConfig(req, api, "Sorry, something went wrong while saving this channel's settings.")
+		return
+	}
+	channelSettings.Set(req.Channel, &settings)
+
+	replyConfig(req, api, describeSettings(&settings))
+}
+
+// describeSettings lists the channel's settings for the config command
+func describeSettings(settings *ChannelSettings) string {
+	sb := strings.Builder{}
+	sb.WriteString(fmt.Sprintf("Settings for <#%v>:\n", settings.Name))
+
+	if settings.Enabled {
+		sb.WriteString(">Enabled: yes\n")
+	} else {
+		sb.WriteString(">Enabled: no\n")
+	}
+
+	policy := BotConfig.Policy()
+	if settings.Allowance > 0 {
+		sb.WriteString(fmt.Sprintf(">Allowance: %v in this channel\n", policy.Per(settings.Allowance)))
+	} else {
+		sb.WriteString(fmt.Sprintf(">Allowance: default (%v)\n", policy.Per(policy.Amount())))
+	}
+
+	if len(settings.Emojis) > 0 {
+		sb.WriteString(fmt.Sprintf(">Emojis: %v\n", formatEmojiList(settings.Emojis)))
+	} else {
+		sb.WriteString(">Emojis: any\n")
+	}
+
+	if settings.Announce {
+		sb.WriteString(">Announcements: on")
+	} else {
+		sb.WriteString(">Announcements: off")
+	}
+
+	return sb.String()
+}
+
+// replyConfig answers a config command, only showing the answer to the user who sent it
+func replyConfig(req *Request, api Chat, text string) {
+	err := req.Reply(api, true, text)
+	if err != nil {
+		log.Printf("Error while sending message to %v: %v\n", req.Channel, err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// lastReply returns the text of the last message posted to the channel
+func (b *testBot) lastReply(channel string) string {
+	b.t.Helper()
+	posted := b.slack.posted(channel)
+	if len(posted) == 0 {
+		b.t.Fatalf("expected a reply in %v", channel)
+	}
+	return posted[len(posted)-1].Text
+}
+
+func TestConfigShowsSettings(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> config")
+	reply := bot.lastReply("CGENERAL")
+	for _, expected := range []string{"Enabled: yes", "Allowance: default (5 kudos per day)", "Emojis: any", "Announcements: off"} {
+		if !strings.Contains(reply, expected) {
+			t.Errorf("expected settings to contain %q, got %q", expected, reply)
+		}
+	}
+}
+
+func TestConfigAllowance(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UALICE", "GSECRET", "<@UBOT> enable")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> config allowance 2")
+	if reply := bot.lastReply("CGENERAL"); !strings.Contains(reply, "Allowance: 2 kudos per day in this channel") {
+		t.Errorf("unexpected reply %q", reply)
+	}
+	bot.say("UALICE", "CGENERAL", "<@UBOT> config allowance lots")
+	if reply := bot.lastReply("CGENERAL"); !strings.Contains(reply, "isn't a valid allowance") {
+		t.Errorf("unexpected reply %q", reply)
+	}
+
+	// The settings are stored, not only cached
+	channelSettings.Clear()
+	settings, err := bot.store.ChannelSettings("CGENERAL")
+	if err != nil || settings.Allowance != 2 || !settings.Enabled {
+		t.Fatalf("expected #general to be stored with an allowance of 2, got %+v (%v)", settings, err)
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco:")
+	bot.expectDM("UALICE", "you only have 2 kudos left to give today in this channel")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco:")
+	bot.expectDM("UALICE", "You don't have any kudos left to give today in this channel.")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	bot.expectDM("UALICE", "You can only give 2 kudos per day in this channel")
+
+	// The channel's allowance is separate from the global one
+	bot.say("UALICE", "GSECRET", "<@UBOB> :star: :star: :star: :star: :star:")
+	if got := bot.received("UBOB"); got != 7 {
+		t.Errorf("expected bob to have received 7 kudos, got %v", got)
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> config allowance default")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	bot.expectDM("UALICE", "You can only give 5 kudos per day")
+}
+
+func TestConfigEmojis(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> config emojis :taco: :star:")
+	if reply := bot.lastReply("CGENERAL"); !strings.Contains(reply, "Emojis: :taco:, :star:") {
+		t.Errorf("unexpected reply %q", reply)
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :heart:")
+	if got := bot.received("UBOB"); got != 1 {
+		t.Errorf("expected only the taco to count, got %v kudos", got)
+	}
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :heart:")
+	bot.expectDM("UALICE", "only :taco:, :star: can be given as kudos in this channel")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> config emojis any")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :heart:")
+	if got := bot.received("UBOB"); got != 2 {
+		t.Errorf("expected any emoji to count again, got %v kudos", got)
+	}
+}
+
+func TestConfigAnnounce(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UALICE", "CGENERAL", "<@UBOT> config announce on")
+	bot.slack.reset()
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	if reply := bot.lastReply("CGENERAL"); reply != "`alice` just gave `bob` kudos: :taco:: `1`" {
+		t.Errorf("unexpected announcement %q", reply)
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> config announce off")
+	bot.slack.reset()
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	if posted := bot.slack.posted("CGENERAL"); len(posted) != 0 {
+		t.Errorf("expected no announcement, got %+v", posted[0])
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"github.com/nlopes/slack"
+)
+
+// Chat is the part of the Slack Web API the handlers use. *slack.Client implements it, and so does the fake workspace
+// the tests run the handlers against.
+type Chat interface {
+	// GetUserInfo looks up a user by their Slack id
+	GetUserInfo(user string) (*slack.User, error)
+	// OpenIMChannel opens a direct message channel with the user, returning the channel's id as the third value
+	OpenIMChannel(user string) (bool, bool, string, error)
+	// PostMessage posts a message to the channel, returning the channel and the timestamp of the new message
+	PostMessage(channelID string, options ...slack.MsgOption) (string, string, error)
+	// GetConversationInfo looks up a channel, private channel or direct message by its id
+	GetConversationInfo(channelID string, includeLocale bool) (*slack.Channel, error)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nlopes/slack"
+	"sync"
+	"testing"
+)
+
+// These tests are meant to be run with -race, where they prove the handlers are safe to run concurrently the way the
+// event loop runs them
+
+func TestConcurrentMessages(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.AmountPerDay = 1000
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	senders := []string{"UALICE", "UCAROL"}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		for _, sender := range senders {
+			wg.Add(1)
+			go func(sender string, i int) {
+				defer wg.Done()
+				MessageHandler(&Request{
+					MessageEvent: &slack.MessageEvent{
+						Msg: slack.Msg{
+							Type:      "message",
+							Channel:   "CGENERAL",
+							User:      sender,
+							Text:      "<@UBOB> :taco: :thumbsup:",
+							Timestamp: fmt.Sprintf("1700000000.%v%06d", sender, i),
+						},
+					},
+				}, bot.slack, bot.store)
+			}(sender, i)
+		}
+	}
+
+	// Commands and changes to the caches happen alongside the kudos
+	for i := 0; i < 5; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			bot.say("UBOB", "CGENERAL", "<@UBOT> leaderboard :taco:")
+		}()
+		go func() {
+			defer wg.Done()
+			bot.say("UBOB", "CGENERAL", "<@UBOT> config")
+		}()
+		go func(i int) {
+			defer wg.Done()
+			EmojiChangedHandler(&EmojiChangedEvent{
+				EmojiChangedEvent: slack.EmojiChangedEvent{SubType: "add", Name: fmt.Sprintf("custom%v", i), Value: "alias:taco"},
+			}, bot.store)
+		}(i)
+	}
+	wg.Wait()
+
+	if got := bot.received("UBOB"); got != 80 {
+		t.Errorf("expected bob to have received 80 kudos, got %v", got)
+	}
+	if !isEmoji("custom4") {
+		t.Errorf("expected custom4 to be an emoji")
+	}
+}
+
+func TestConcurrentReactions(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.AmountPerDay = 1000
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ev := &slack.ReactionAddedEvent{User: "UALICE", ItemUser: "UBOB", Reaction: "star"}
+			ev.Item.Type = "message"
+			ev.Item.Channel = "CGENERAL"
+			ev.Item.Timestamp = fmt.Sprintf("1700000000.%06d", i)
+			ReactionAddedHandler(ev, bot.slack, bot.store)
+		}(i)
+	}
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		bot.say("UCAROL", "CGENERAL", "<@UBOT> disable")
+	}()
+	go func() {
+		defer wg.Done()
+		bot.say("UCAROL", "CGENERAL", "<@UBOT> enable")
+	}()
+	wg.Wait()
+
+	if got := bot.received("UBOB"); got > 20 {
+		t.Errorf("expected bob to have received at most 20 kudos, got %v", got)
+	}
+}
+
+func TestConcurrentMessagesCantOverspend(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UALICE", "GSECRET", "<@UBOT> enable")
+	bot.say("UALICE", "GSECRET", "<@UBOT> config allowance 3")
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+		}()
+		go func() {
+			defer wg.Done()
+			bot.say("UALICE", "GSECRET", "<@UCAROL> :taco:")
+		}()
+	}
+	wg.Wait()
+
+	if got := bot.received("UBOB"); got != 5 {
+		t.Errorf("expected bob to have received exactly the daily allowance of 5 kudos, got %v", got)
+	}
+	if got := bot.received("UCAROL"); got != 3 {
+		t.Errorf("expected carol to have received exactly the channel allowance of 3 kudos, got %v", got)
+	}
+}
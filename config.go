@@ -4,15 +4,148 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"log"
+	"time"
 )
 
 var BotConfig *Config
 
+// The ways events can be delivered from Slack to the bot
+const (
+	// ModeRTM connects to Slack's real time messaging API over a websocket
+	ModeRTM = "rtm"
+	// ModeEvents has Slack send events to the bot's HTTP server through the Events API
+	ModeEvents = "events"
+	// ModeSocket connects to Slack over a websocket with Socket Mode, using an app-level token
+	ModeSocket = "socket"
+)
+
 type Config struct {
-	BotToken     string `json:"botToken"`
-	UserToken    string `json:"userToken"`
-	DbConfig     `json:"db"`
-	AmountPerDay int `json:"amountPerDay"`
+	Mode          string `json:"mode"`
+	BotToken      string `json:"botToken"`
+	UserToken     string `json:"userToken"`
+	AppToken      string `json:"appToken"`
+	SigningSecret string `json:"signingSecret"`
+	ListenAddress string `json:"listenAddress"`
+	DbConfig      `json:"db"`
+	AmountPerDay  int `json:"amountPerDay"`
+	// Allowance chooses how the kudos everyone can give are limited, by default it's AmountPerDay every day
+	Allowance AllowanceConfig `json:"allowance"`
+	// RecipientCaps limits how many kudos a sender can give any one recipient
+	RecipientCaps RecipientCapsConfig `json:"recipientCaps"`
+	// EmojiWeights is how many points each emoji is worth, by emoji name. Emojis which aren't listed are worth 1.
+	EmojiWeights map[string]int `json:"emojiWeights"`
+	Emoji        EmojiConfig    `json:"emoji"`
+	// Admins are the users allowed to manage channels and moderate kudos, by Slack id or username, in addition to the
+	// admins and owners of the Slack workspace
+	Admins []string `json:"admins"`
+}
+
+// AllowanceConfig chooses the allowance policy and its settings. Settings which don't apply to the policy are ignored.
+type AllowanceConfig struct {
+	// Policy is one of PolicyDaily (the default), PolicyWeekly, PolicyRolling or PolicyCarryOver
+	Policy string `json:"policy"`
+	// Amount is how many kudos everyone gets. It defaults to AmountPerDay, or a week's worth of it for PolicyWeekly.
+	Amount int `json:"amount"`
+	// Hours is how long the window of PolicyRolling is, 24 hours by default
+	Hours int `json:"hours"`
+	// Cap is the most kudos which can be saved up with PolicyCarryOver, 3 days worth by default
+	Cap int `json:"cap"`
+}
+
+// RecipientCapsConfig is how many kudos a sender can give any one recipient each day, week and month. Periods which
+// aren't set aren't limited.
+type RecipientCapsConfig struct {
+	Day   int `json:"day"`
+	Week  int `json:"week"`
+	Month int `json:"month"`
+}
+
+// caps returns the configured caps for a sender at the given time, starting at the beginning of each period in the
+// sender's time zone
+func (c RecipientCapsConfig) caps(user *User, at time.Time) []*RecipientCap {
+	loc := user.Location()
+	day := startOfDay(at, loc)
+	caps := make([]*RecipientCap, 0, 3)
+	if c.Day > 0 {
+		caps = append(caps, &RecipientCap{Period: "day", Since: day, Limit: c.Day})
+	}
+	if c.Week > 0 {
+		caps = append(caps, &RecipientCap{Period: "week", Since: startOfWeek(at, loc), Limit: c.Week})
+	}
+	if c.Month > 0 {
+		month := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, loc)
+		caps = append(caps, &RecipientCap{Period: "month", Since: month, Limit: c.Month})
+	}
+	return caps
+}
+
+// EmojiConfig controls where emojis come from. The standard emoji set is always bundled, the sources here are pulled
+// whenever an emoji isn't recognized, but no more often than every RefreshInterval seconds.
+type EmojiConfig struct {
+	// StandardURL is an optional emoji-data formatted emoji.json, which adds to the bundled standard emoji set
+	StandardURL string `json:"standardUrl"`
+	// Custom pulls the workspace's custom emojis from Slack with the user token
+	Custom bool `json:"custom"`
+	// RefreshInterval is the minimum number of seconds between pulling the emoji sources
+	RefreshInterval int `json:"refreshInterval"`
+	// UnknownTTL is how many seconds a name is remembered as not being an emoji
+	UnknownTTL int `json:"unknownTtl"`
+	// RenameKudos moves kudos given with a custom emoji to its new name when it's renamed
+	RenameKudos bool `json:"renameKudos"`
+}
+
+// Defaults for the emoji settings which aren't set
+const (
+	defaultEmojiRefreshInterval = 5 * time.Minute
+	defaultUnknownEmojiTTL      = time.Hour
+)
+
+// hasSources determines if there's anywhere to pull emojis from besides the bundled set
+func (c EmojiConfig) hasSources() bool {
+	return c.Custom || c.StandardURL != ""
+}
+
+func (c EmojiConfig) refreshInterval() time.Duration {
+	if c.RefreshInterval <= 0 {
+		return defaultEmojiRefreshInterval
+	}
+	return time.Duration(c.RefreshInterval) * time.Second
+}
+
+func (c EmojiConfig) unknownTtl() time.Duration {
+	if c.UnknownTTL <= 0 {
+		return defaultUnknownEmojiTTL
+	}
+	return time.Duration(c.UnknownTTL) * time.Second
+}
+
+// EmojiWeight returns how many points a single one of the emoji is worth. The weights can be configured under any of
+// an emoji's aliases.
+func (c *Config) EmojiWeight(emoji string) int {
+	weight, ok := c.EmojiWeights[emoji]
+	if !ok {
+		for name, w := range c.EmojiWeights {
+			if normalizeEmoji(name) == emoji {
+				weight, ok = w, true
+				break
+			}
+		}
+	}
+	if !ok || weight < 1 {
+		return 1
+	}
+	return weight
+}
+
+// Policy returns the configured allowance policy. ReadConfig makes sure it's valid, a broken configuration falls back
+// to the daily policy anyway.
+func (c *Config) Policy() AllowancePolicy {
+	policy, err := newAllowancePolicy(c)
+	if err != nil {
+		log.Printf("Invalid allowance configuration, using the daily allowance instead: %v\n", err)
+		return &dailyPolicy{c.AmountPerDay}
+	}
+	return policy
 }
 
 func ReadConfig() {
@@ -21,9 +154,13 @@ func ReadConfig() {
 		log.Fatalf("Failed to read configuration file: %v\n", err)
 	}
 
-	BotConfig = &Config{}
+	BotConfig = &Config{Mode: ModeRTM, Emoji: EmojiConfig{Custom: true}}
 	err = json.Unmarshal(data, BotConfig)
 	if err != nil {
 		log.Fatalf("Failed to parse configuration file: %v\n", err)
 	}
+
+	if _, err = newAllowancePolicy(BotConfig); err != nil {
+		log.Fatalf("Invalid allowance configuration: %v\n", err)
+	}
 }
@@ -1,40 +1,39 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
-	"github.com/go-sql-driver/mysql"
-	"log"
 )
 
+// The databases which can be used to store kudos
+const (
+	DriverMysql    = "mysql"
+	DriverSqlite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// DbConfig describes which database to use and how to connect to it. MySQL and PostgreSQL use the connection details,
+// while SQLite only needs the path to the database file.
 type DbConfig struct {
+	Driver   string `json:"driver"`
 	Database string `json:"database"`
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Hostname string `json:"hostname"`
 	Port     int    `json:"port"`
+	Path     string `json:"path"`
+	SslMode  string `json:"sslMode"`
 }
 
-func (conf DbConfig) Connect() (*sql.DB, error) {
-	config := mysql.Config{
-		User:                 conf.Username,
-		Passwd:               conf.Password,
-		Net:                  "tcp",
-		Addr:                 fmt.Sprintf("%v:%v", conf.Hostname, conf.Port),
-		DBName:               conf.Database,
-		AllowNativePasswords: true,
-	}
-	dsn := config.FormatDSN()
-	log.Printf("Using %v to connect to database\n", dsn)
-	return sql.Open(
-		"mysql",
-		dsn,
-	)
-}
-
-func CloseRows(rows *sql.Rows) {
-	if rows == nil {
-		return
+func (conf DbConfig) Connect() (Store, error) {
+	switch conf.Driver {
+	case "", DriverMysql:
+		return newMysqlStore(conf)
+	case DriverSqlite:
+		return newSqliteStore(conf)
+	case DriverPostgres:
+		return newPostgresStore(conf)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q, must be one of %q, %q or %q", conf.Driver, DriverMysql,
+			DriverSqlite, DriverPostgres)
 	}
-	_ = rows.Close()
 }
@@ -1,59 +1,176 @@
 package main
 
 import (
+	"bytes"
+	_ "embed"
 	"encoding/json"
+	"fmt"
 	"github.com/nlopes/slack"
+	"io"
 	"log"
 	"net/http"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 )
 
+// standardEmojiData is the standard Slack emoji set, in the same format as emoji-data's emoji.json but with only the
+// short names kept. It's bundled so emojis can be recognized without any network access, and can be regenerated with:
+//
+//	curl https://raw.githubusercontent.com/iamcal/emoji-data/master/emoji.json |
+//		jq -c '[.[] | {short_name, short_names}]' > data/emoji.json
+//
+//go:embed data/emoji.json
+var standardEmojiData []byte
+
 var (
 	emojiApiKey string
-	emojiCache  = make(map[string]bool)
-	emojiMutex  = &sync.Mutex{}
+	// emojiCache maps every known emoji name, including aliases, to the emoji's canonical name. Emojis don't expire,
+	// they're only removed when Slack says they were.
+	emojiCache = newCache("emoji", 0)
+	// unknownEmojis remembers names which aren't emojis for the configured unknownTtl, so they don't cause refreshes
+	unknownEmojis = newCache("unknown emoji", 0)
+	// lastEmojiRefresh is when the emoji lists were last pulled from their sources
+	lastEmojiRefresh time.Time
+	// standardEmojis loads the bundled emoji set the first time any emoji is looked up
+	standardEmojis sync.Once
+	// emojiMutex is held while the emoji lists are changed, so refreshes and emoji_changed events don't interleave.
+	// Looking up emojis doesn't need it.
+	emojiMutex = &sync.Mutex{}
 )
 
-// isEmoji checks if the given name is recognized as an emoji - either standard or custom. It keeps an in-memory cache
-// of the emoji lists to keep the network calls less frequent (the calls can be quite time consuming) but any name given
-// that isn't in the cache will cause a full refresh of the emoji list to account for newly added emojis.
-func isEmoji(name string) (valid bool) {
-	_, valid = emojiCache[name]
-	if valid {
-		return
+// cachedEmoji looks up the canonical name of the emoji in the cache
+func cachedEmoji(name string) (string, bool) {
+	canonical, ok := emojiCache.Get(name)
+	if !ok {
+		return "", false
 	}
+	return canonical.(string), true
+}
 
-	pullAllEmojis()
-	_, valid = emojiCache[name]
-	return
+// skinTonePattern matches the skin tone modifier Slack appends to an emoji, such as the "::skin-tone-3" in a
+// "thumbsup::skin-tone-3" reaction. Modifiers aren't emojis of their own, they belong to the emoji they're attached to.
+var skinTonePattern = regexp.MustCompile("^skin-tone-[2-6]$|::skin-tone-[2-6]$")
+
+// isEmoji checks if the given name is recognized as an emoji - either standard or custom.
+func isEmoji(name string) bool {
+	_, valid := canonicalEmoji(name)
+	return valid
 }
 
-// pullAllEmojis wraps pullStandardEmojis and pullCustomEmojis around a mutex to prevent the lists from being updated
-// concurrently
-func pullAllEmojis() {
+// canonicalEmoji returns the canonical name of the emoji, which is what kudos are recorded and counted under. Aliases
+// such as "thumbsup" for "+1" and custom emojis which are aliases of other emojis all count as the emoji they're an
+// alias of, and skin tones count as the emoji without a skin tone.
+//
+// The standard emojis are bundled, but custom emojis have to be pulled from Slack. A name which isn't known causes the
+// emoji lists to be refreshed to account for newly added emojis, but no more often than the configured refresh
+// interval. Names which still aren't known afterwards are remembered as unknown for a while, so looking them up again
+// doesn't cost anything.
+func canonicalEmoji(name string) (string, bool) {
+	name = skinTonePattern.ReplaceAllString(name, "")
+	if name == "" {
+		return "", false
+	}
+
+	standardEmojis.Do(loadStandardEmojis)
+
+	if canonical, ok := cachedEmoji(name); ok {
+		return canonical, true
+	}
+	if _, ok := unknownEmojis.Get(name); ok {
+		return "", false
+	}
+
 	emojiMutex.Lock()
 	defer emojiMutex.Unlock()
 
-	pullStandardEmojis()
-	pullCustomEmojis()
+	// Another message may have refreshed the emojis while this one was waiting
+	if canonical, ok := cachedEmoji(name); ok {
+		return canonical, true
+	}
+
+	now := time.Now()
+	if BotConfig.Emoji.hasSources() && now.Sub(lastEmojiRefresh) >= BotConfig.Emoji.refreshInterval() {
+		refreshEmojis()
+		lastEmojiRefresh = now
+		if canonical, ok := cachedEmoji(name); ok {
+			return canonical, true
+		}
+	}
+
+	unknownEmojis.SetWithTTL(name, now, BotConfig.Emoji.unknownTtl())
+	return "", false
 }
 
-// pullStandardEmojis grabs the standard emoji data set for emojis that are included in the base slack package - these
-// aren't necessarily slack specific, but they are what slack uses as it's default emoji set.
-func pullStandardEmojis() {
-	var url = "https://raw.githubusercontent.com/iamcal/emoji-data/master/emoji.json"
+// normalizeEmoji returns the canonical name of the emoji, or the name without any skin tone if it's not an emoji that
+// is known
+func normalizeEmoji(name string) string {
+	if canonical, ok := canonicalEmoji(name); ok {
+		return canonical
+	}
+	return skinTonePattern.ReplaceAllString(name, "")
+}
 
-	type EmojiData struct {
-		ShortNames []string `json:"short_names"`
+// emojiAliases returns every name the emoji is known by, starting with its canonical name. Kudos recorded before
+// emojis were normalized may be stored under any of them.
+func emojiAliases(emoji string) []string {
+	canonical := normalizeEmoji(emoji)
+
+	aliases := make([]string, 0)
+	emojiCache.Range(func(name string, c interface{}) bool {
+		if c == canonical && name != canonical {
+			aliases = append(aliases, name)
+		}
+		return true
+	})
+
+	sort.Strings(aliases)
+	return append([]string{canonical}, aliases...)
+}
+
+// expandEmojiAliases returns the emojis along with all of their aliases, for matching stored kudos against emojis
+func expandEmojiAliases(emojis []string) []string {
+	expanded := make([]string, 0, len(emojis))
+	for _, emoji := range emojis {
+		expanded = append(expanded, emojiAliases(emoji)...)
+	}
+	return unique(expanded)
+}
+
+// loadStandardEmojis adds the bundled standard emoji set to the cache
+func loadStandardEmojis() {
+	emojiMutex.Lock()
+	defer emojiMutex.Unlock()
+
+	if err := addStandardEmojis(bytes.NewReader(standardEmojiData)); err != nil {
+		log.Printf("Failed to load the bundled standard emoji set: %v\n", err)
 	}
+}
+
+// refreshEmojis pulls the emoji lists from every configured source. Everything previously found to be unknown is
+// forgotten, since it may be known now. The caller has to hold emojiMutex.
+func refreshEmojis() {
+	if BotConfig.Emoji.StandardURL != "" {
+		pullStandardEmojis(BotConfig.Emoji.StandardURL)
+	}
+	if BotConfig.Emoji.Custom {
+		pullCustomEmojis()
+	}
+	unknownEmojis.Clear()
+}
 
+// pullStandardEmojis grabs a standard emoji data set in the emoji-data format, adding to the bundled set. These aren't
+// necessarily slack specific, but they are what slack uses as it's default emoji set.
+func pullStandardEmojis(url string) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		log.Printf("Failed to get standard Slack emoji set: %v\n", err)
 		return
 	}
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: 30 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Printf("Failed to get standard Slack emoji set: %v\n", err)
@@ -67,21 +184,47 @@ func pullStandardEmojis() {
 		}
 	}()
 
-	var data []EmojiData
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Failed to get standard Slack emoji set: %v returned %v\n", url, resp.Status)
+		return
+	}
+
+	if err := addStandardEmojis(resp.Body); err != nil {
 		log.Printf("Failed to decode standard Slack emoji request: %v\n", err)
 	}
+}
+
+// addStandardEmojis adds every emoji in the emoji-data formatted JSON to the cache. The caller has to hold emojiMutex.
+func addStandardEmojis(r io.Reader) error {
+	type EmojiData struct {
+		ShortName  string   `json:"short_name"`
+		ShortNames []string `json:"short_names"`
+	}
+
+	var data []EmojiData
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return fmt.Errorf("no emojis found")
+	}
 
 	for _, emoji := range data {
+		// Skin tones are modifiers, not emojis which can be given on their own
+		if skinTonePattern.MatchString(emoji.ShortName) {
+			continue
+		}
 		for _, name := range emoji.ShortNames {
-			emojiCache[name] = true
+			emojiCache.Set(name, emoji.ShortName)
 		}
 	}
+	return nil
 }
 
 // pullCustomEmojis queries the slack API to pull in the names of all custom emojis for the workspace. This uses the
 // emojiApiKey that is separate from the bot token that is used for all other API calls. This API in particular is
-// different and does not work with the bot API token.
+// different and does not work with the bot API token. Custom emojis which are aliases ("alias:<name>") are recorded as
+// the emoji they're an alias of. The caller has to hold emojiMutex.
 func pullCustomEmojis() {
 	api := slack.New(emojiApiKey)
 	ec, err := api.GetEmoji()
@@ -89,7 +232,100 @@ func pullCustomEmojis() {
 		log.Printf("Failed to pull emoji list: %v", err)
 		return
 	}
-	for k := range ec {
-		emojiCache[k] = true
+
+	aliases := make(map[string]string)
+	for k, v := range ec {
+		if strings.HasPrefix(v, "alias:") {
+			aliases[k] = strings.TrimPrefix(v, "alias:")
+			continue
+		}
+		emojiCache.Set(k, k)
+	}
+	for k, target := range aliases {
+		if canonical, ok := cachedEmoji(target); ok {
+			emojiCache.Set(k, canonical)
+		} else {
+			emojiCache.Set(k, target)
+		}
+	}
+}
+
+// EmojiChangedEvent is sent when a custom emoji is added, removed or renamed. The event from nlopes/slack doesn't have
+// the old and new names of renamed emojis, so this adds them.
+type EmojiChangedEvent struct {
+	slack.EmojiChangedEvent
+	OldName string `json:"old_name"`
+	NewName string `json:"new_name"`
+}
+
+// EmojiChangedHandler applies a change to the custom emojis to the emoji cache as it happens, instead of waiting for the
+// next refresh. If renameKudos is configured, kudos given with a renamed emoji are moved to the new name as well.
+func EmojiChangedHandler(ev *EmojiChangedEvent, store Store) {
+	switch ev.SubType {
+	case "add":
+		log.Printf("Custom emoji %v added\n", ev.Name)
+		addCustomEmoji(ev.Name, ev.Value)
+	case "remove":
+		log.Printf("Custom emojis %v removed\n", strings.Join(ev.Names, ", "))
+		removeCustomEmojis(ev.Names)
+	case "rename":
+		log.Printf("Custom emoji %v renamed to %v\n", ev.OldName, ev.NewName)
+		renameCustomEmoji(ev.OldName, ev.NewName)
+		if BotConfig.Emoji.RenameKudos {
+			if err := store.RenameEmoji(ev.OldName, ev.NewName); err != nil {
+				log.Printf("Failed to rename kudos from %v to %v: %v\n", ev.OldName, ev.NewName, err)
+			}
+		}
+	}
+}
+
+// addCustomEmoji adds a new custom emoji to the cache. The value is either the emoji's image or "alias:<name>" if it's
+// an alias of another emoji.
+func addCustomEmoji(name string, value string) {
+	emojiMutex.Lock()
+	defer emojiMutex.Unlock()
+
+	canonical := name
+	if strings.HasPrefix(value, "alias:") {
+		canonical = strings.TrimPrefix(value, "alias:")
+		if c, ok := cachedEmoji(canonical); ok {
+			canonical = c
+		}
+	}
+	emojiCache.Set(name, canonical)
+	unknownEmojis.Delete(name)
+}
+
+// removeCustomEmojis removes the custom emojis from the cache, along with any aliases of them
+func removeCustomEmojis(names []string) {
+	emojiMutex.Lock()
+	defer emojiMutex.Unlock()
+
+	removed := make(map[string]bool, len(names))
+	for _, name := range names {
+		removed[name] = true
+	}
+	emojiCache.DeleteFunc(func(name string, canonical interface{}) bool {
+		return removed[name] || removed[canonical.(string)]
+	})
+}
+
+// renameCustomEmoji moves the custom emoji to its new name in the cache, along with any aliases of it
+func renameCustomEmoji(oldName string, newName string) {
+	emojiMutex.Lock()
+	defer emojiMutex.Unlock()
+
+	aliases := make([]string, 0)
+	emojiCache.Range(func(name string, canonical interface{}) bool {
+		if canonical == oldName && name != oldName {
+			aliases = append(aliases, name)
+		}
+		return true
+	})
+	for _, alias := range aliases {
+		emojiCache.Set(alias, newName)
 	}
+	emojiCache.Delete(oldName)
+	emojiCache.Set(newName, newName)
+	unknownEmojis.Delete(newName)
 }
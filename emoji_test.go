@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"github.com/gorilla/websocket"
+	"github.com/nlopes/slack"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resetEmojis forgets everything but the bundled emoji set
+func resetEmojis() {
+	standardEmojis.Do(loadStandardEmojis)
+	emojiMutex.Lock()
+	defer emojiMutex.Unlock()
+	emojiCache.Clear()
+	unknownEmojis.Clear()
+	lastEmojiRefresh = time.Time{}
+	_ = addStandardEmojis(bytes.NewReader(standardEmojiData))
+}
+
+func TestBundledEmojis(t *testing.T) {
+	BotConfig = &Config{}
+	resetEmojis()
+
+	for name, expected := range map[string]string{
+		"taco":                  "taco",
+		"thumbsup":              "+1",
+		"+1::skin-tone-4":       "+1",
+		"slightly_smiling_face": "slightly_smiling_face",
+	} {
+		canonical, ok := canonicalEmoji(name)
+		if !ok || canonical != expected {
+			t.Errorf("expected %v to be the emoji %v, got %q (%v)", name, expected, canonical, ok)
+		}
+	}
+
+	for _, name := range []string{"skin-tone-2", "notarealemoji", ""} {
+		if isEmoji(name) {
+			t.Errorf("expected %q not to be an emoji", name)
+		}
+	}
+}
+
+func TestEmojiRefreshIsThrottled(t *testing.T) {
+	var requests int32
+	var body atomic.Value
+	body.Store(`[{"short_name":"party_blob","short_names":["party_blob","blob_party"]}]`)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write([]byte(body.Load().(string)))
+	}))
+	defer server.Close()
+
+	BotConfig = &Config{Emoji: EmojiConfig{StandardURL: server.URL, RefreshInterval: 3600}}
+	resetEmojis()
+
+	// The first unknown name refreshes the emoji lists, which finds the new emoji
+	if canonical, ok := canonicalEmoji("blob_party"); !ok || canonical != "party_blob" {
+		t.Errorf("expected blob_party to be found as party_blob, got %q (%v)", canonical, ok)
+	}
+
+	// Unknown names don't cause any more refreshes until the interval has passed
+	for i := 0; i < 10; i++ {
+		if isEmoji("notarealemoji") {
+			t.Errorf("expected notarealemoji not to be an emoji")
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("expected a single request for emojis, got %v", got)
+	}
+
+	// Once the interval has passed and the name is no longer remembered as unknown, it's looked up again
+	emojiMutex.Lock()
+	lastEmojiRefresh = time.Now().Add(-2 * time.Hour)
+	unknownEmojis.Delete("notarealemoji")
+	emojiMutex.Unlock()
+	body.Store(`[{"short_name":"notarealemoji","short_names":["notarealemoji"]}]`)
+	if !isEmoji("notarealemoji") {
+		t.Errorf("expected notarealemoji to be found after the refresh")
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("expected two requests for emojis, got %v", got)
+	}
+}
+
+func TestEmojiChanged(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.Emoji.RenameKudos = true
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	ev, err := parseEvent([]byte(`{"type":"emoji_changed","subtype":"add","name":"partyparrot","value":"https://emoji.slack-edge.com/partyparrot.gif"}`))
+	if err != nil {
+		t.Fatalf("failed to parse event: %v", err)
+	}
+	EmojiChangedHandler(ev.Data.(*EmojiChangedEvent), bot.store)
+	EmojiChangedHandler(&EmojiChangedEvent{
+		EmojiChangedEvent: slack.EmojiChangedEvent{SubType: "add", Name: "parrot", Value: "alias:partyparrot"},
+	}, bot.store)
+	if canonical, ok := canonicalEmoji("parrot"); !ok || canonical != "partyparrot" {
+		t.Errorf("expected parrot to be an alias of partyparrot, got %q (%v)", canonical, ok)
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :partyparrot:")
+	bot.say("UCAROL", "CGENERAL", "<@UBOB> :fastparrot:")
+	if got := bot.received("UBOB"); got != 1 {
+		t.Fatalf("expected bob to have 1 kudos, got %v", got)
+	}
+
+	ev, err = parseEvent([]byte(`{"type":"emoji_changed","subtype":"rename","old_name":"partyparrot","new_name":"fastparrot","value":"https://emoji.slack-edge.com/fastparrot.gif"}`))
+	if err != nil {
+		t.Fatalf("failed to parse event: %v", err)
+	}
+	EmojiChangedHandler(ev.Data.(*EmojiChangedEvent), bot.store)
+	if isEmoji("partyparrot") {
+		t.Errorf("expected partyparrot to be gone after the rename")
+	}
+	if canonical, ok := canonicalEmoji("parrot"); !ok || canonical != "fastparrot" {
+		t.Errorf("expected parrot to follow the rename, got %q (%v)", canonical, ok)
+	}
+
+	// The kudos already given are merged with the ones given under the new name
+	bot.say("UCAROL", "CGENERAL", "<@UBOB> :fastparrot:")
+	user, _ := bot.store.UserBySlackId("UBOB")
+	rows, err := bot.store.Stats(user.Id, []string{"fastparrot"}, nil, true)
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected fastparrot kudos from two senders, got %+v", rows)
+	}
+	for _, row := range rows {
+		if row.Emoji != "fastparrot" || row.Count != 1 {
+			t.Errorf("unexpected kudos %+v", row)
+		}
+	}
+
+	EmojiChangedHandler(&EmojiChangedEvent{
+		EmojiChangedEvent: slack.EmojiChangedEvent{SubType: "remove", Names: []string{"fastparrot"}},
+	}, bot.store)
+	if isEmoji("fastparrot") || isEmoji("parrot") {
+		t.Errorf("expected fastparrot and its alias to be gone after being removed")
+	}
+}
+
+func TestEmojiRenamedOverRTM(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.Emoji.RenameKudos = true
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	EmojiChangedHandler(&EmojiChangedEvent{
+		EmojiChangedEvent: slack.EmojiChangedEvent{SubType: "add", Name: "partyparrot",
+			Value: "https://emoji.slack-edge.com/partyparrot.gif"},
+	}, bot.store)
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :partyparrot:")
+
+	// A local RTM server which sends the rename as soon as the bot connects. The RTM client connects with Slack's own
+	// origin.
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	connect := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"ok":true,"url":"ws` + strings.TrimPrefix(server.URL, "http") + `/websocket",` +
+			`"self":{"id":"UBOT","name":"heykudos"},"team":{"id":"T1","name":"Test","domain":"test"}}`))
+	}
+	mux.HandleFunc("/rtm.start", connect)
+	mux.HandleFunc("/rtm.connect", connect)
+	mux.HandleFunc("/websocket", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade the connection: %v", err)
+			return
+		}
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"hello"}`))
+		_ = conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"emoji_changed","subtype":"rename",`+
+			`"old_name":"partyparrot","new_name":"fastparrot","value":"https://emoji.slack-edge.com/fastparrot.gif"}`))
+	})
+
+	apiURL := slack.APIURL
+	slack.APIURL = server.URL + "/"
+	t.Cleanup(func() {
+		slack.APIURL = apiURL
+	})
+
+	mapEventTypes()
+	rtm := slack.New("xoxb-test").NewRTM()
+	go rtm.ManageConnection()
+	t.Cleanup(func() {
+		_ = rtm.Disconnect()
+	})
+
+	var ev *EmojiChangedEvent
+	for ev == nil {
+		select {
+		case msg := <-rtm.IncomingEvents:
+			if msg.Type == "emoji_changed" {
+				var ok bool
+				if ev, ok = msg.Data.(*EmojiChangedEvent); !ok {
+					t.Fatalf("expected the event to be decoded with both names, got %T", msg.Data)
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the emoji_changed event")
+		}
+	}
+	if ev.OldName != "partyparrot" || ev.NewName != "fastparrot" {
+		t.Fatalf("expected partyparrot to be renamed to fastparrot, got %+v", ev)
+	}
+
+	EmojiChangedHandler(ev, bot.store)
+	if isEmoji("partyparrot") {
+		t.Errorf("expected partyparrot to be gone after the rename")
+	}
+	user, _ := bot.store.UserBySlackId("UBOB")
+	rows, err := bot.store.Stats(user.Id, nil, nil, true)
+	if err != nil {
+		t.Fatalf("failed to get stats: %v", err)
+	}
+	if len(rows) != 1 || rows[0].Emoji != "fastparrot" || rows[0].Count != 1 {
+		t.Errorf("expected the kudos to be moved to fastparrot, got %+v", rows)
+	}
+}
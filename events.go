@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nlopes/slack"
+	"log"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+const (
+	// eventBufferSize is how many events can be waiting for the event loop before deliveries start to block
+	eventBufferSize = 64
+	// seenEventsSize is how many event ids are remembered to drop events Slack delivers more than once
+	seenEventsSize = 1024
+)
+
+// eventEnvelope is the outer payload of everything Slack sends to the Events API endpoint
+type eventEnvelope struct {
+	Type      string          `json:"type"`
+	Challenge string          `json:"challenge"`
+	EventId   string          `json:"event_id"`
+	Event     json.RawMessage `json:"event"`
+}
+
+// EventsHandler accepts Events API requests from Slack. URL verification challenges are answered directly, every other
+// event is passed on to the event loop through the events channel. Slack retries events it doesn't think were received
+// in time, so events which have already been seen are acknowledged and dropped, as are retries of events which only
+// timed out.
+func EventsHandler(events chan<- slack.RTMEvent) http.HandlerFunc {
+	seen := newSeenEvents(seenEventsSize)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := verifyRequest(r)
+		if err != nil {
+			log.Printf("Rejected event request: %v\n", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		envelope := eventEnvelope{}
+		if err = json.Unmarshal(body, &envelope); err != nil {
+			log.Printf("Failed to parse event: %v\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch envelope.Type {
+		case "url_verification":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(envelope.Challenge))
+		case "event_callback":
+			w.WriteHeader(http.StatusOK)
+
+			// A timed out event reached the bot the first time, even if it's been forgotten since
+			retry, reason := r.Header.Get("X-Slack-Retry-Num"), r.Header.Get("X-Slack-Retry-Reason")
+			if seen.check(envelope.EventId) || retry != "" && reason == "http_timeout" {
+				log.Printf("Dropping duplicate event %v (retry %v, %v)\n", envelope.EventId, retry, reason)
+				return
+			}
+
+			event, err := parseEvent(envelope.Event)
+			if err != nil {
+				log.Printf("Failed to parse event %v: %v\n", envelope.EventId, err)
+				return
+			}
+			if event == nil {
+				return
+			}
+
+			// Waiting for a busy event loop would hold up the response until Slack gives up and sends the event again
+			select {
+			case events <- *event:
+			default:
+				log.Printf("Event loop is busy, queueing event %v\n", envelope.EventId)
+				go func() {
+					events <- *event
+				}()
+			}
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+}
+
+// eventTypes are the events which are decoded into the bot's own types, because the types from nlopes/slack are
+// missing fields the bot needs
+var eventTypes = map[string]interface{}{
+	"emoji_changed": EmojiChangedEvent{},
+}
+
+// mapEventTypes has the RTM API decode events into the bot's own types as well. It has to be called before the RTM
+// connection is started.
+func mapEventTypes() {
+	for name, v := range eventTypes {
+		slack.EventMapping[name] = v
+	}
+}
+
+// parseEvent decodes an Events API event into the same type the RTM API uses for it. The events share the same format,
+// which means everything downstream can handle them the same way. Returns nil for event types the bot doesn't know.
+func parseEvent(raw json.RawMessage) (*slack.RTMEvent, error) {
+	header := struct {
+		Type string `json:"type"`
+	}{}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return nil, err
+	}
+
+	v, ok := eventTypes[header.Type]
+	if !ok {
+		v, ok = slack.EventMapping[header.Type]
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	data := reflect.New(reflect.TypeOf(v)).Interface()
+	if err := json.Unmarshal(raw, data); err != nil {
+		return nil, fmt.Errorf("failed to decode %v event: %v", header.Type, err)
+	}
+
+	return &slack.RTMEvent{Type: header.Type, Data: data}, nil
+}
+
+// seenEvents remembers the most recent event ids. Once full, the oldest ids are forgotten first.
+type seenEvents struct {
+	mutex sync.Mutex
+	ids   map[string]bool
+	order []string
+	next  int
+}
+
+func newSeenEvents(size int) *seenEvents {
+	return &seenEvents{
+		ids:   make(map[string]bool, size),
+		order: make([]string, size),
+	}
+}
+
+// check records the event id, returning true if it had already been seen
+func (s *seenEvents) check(id string) bool {
+	if id == "" {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ids[id] {
+		return true
+	}
+
+	delete(s.ids, s.order[s.next])
+	s.order[s.next] = id
+	s.ids[id] = true
+	s.next = (s.next + 1) % len(s.order)
+	return false
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"github.com/nlopes/slack"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testMessageEvent is alice saying hi in #general, delivered through the Events API
+const testMessageEvent = `{"type":"event_callback","event_id":"Ev1","event":{"type":"message","channel":"CGENERAL",` +
+	`"user":"UALICE","text":"hi","ts":"1600000000.000001"}}`
+
+// postEvent sends the Events API payload to the handler, signed with the secret at the given time. A retry is sent as
+// Slack would after the first delivery timed out.
+func postEvent(handler http.HandlerFunc, body string, secret string, at time.Time,
+	retry string) *httptest.ResponseRecorder {
+	return postRetry(handler, body, secret, at, retry, "http_timeout")
+}
+
+// postRetry sends the Events API payload like postEvent, as a retry for the given reason
+func postRetry(handler http.HandlerFunc, body string, secret string, at time.Time, retry string,
+	reason string) *httptest.ResponseRecorder {
+	r := signedRequest("/slack/events", "application/json", body, secret, at)
+	if retry != "" {
+		r.Header.Set("X-Slack-Retry-Num", retry)
+		r.Header.Set("X-Slack-Retry-Reason", reason)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestEventsURLVerification(t *testing.T) {
+	BotConfig = &Config{SigningSecret: testSigningSecret}
+	handler := EventsHandler(make(chan slack.RTMEvent, 1))
+
+	body := `{"type":"url_verification","token":"x","challenge":"3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P"}`
+	w := postEvent(handler, body, testSigningSecret, time.Now(), "")
+	if w.Code != http.StatusOK || w.Body.String() != "3eZbrw1aBm2rZgRNFdxV2595E9CY3gmdALWMmHkvFXO7tYXAYM8P" {
+		t.Errorf("expected the challenge to be answered, got %v %q", w.Code, w.Body.String())
+	}
+}
+
+func TestEventsRejectsUnsignedRequests(t *testing.T) {
+	BotConfig = &Config{SigningSecret: testSigningSecret}
+	events := make(chan slack.RTMEvent, 1)
+	handler := EventsHandler(events)
+	body := testMessageEvent
+
+	if w := postEvent(handler, body, "not the secret", time.Now(), ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a request with the wrong signature to be rejected, got %v", w.Code)
+	}
+	w := postEvent(handler, body, testSigningSecret, time.Now().Add(-10*time.Minute), "")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected a request with an old timestamp to be rejected, got %v", w.Code)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events to be passed on, got %v", len(events))
+	}
+
+	// Anyone can sign a request with an empty secret, so nothing is accepted without one
+	BotConfig.SigningSecret = ""
+	if w := postEvent(handler, body, "", time.Now(), ""); w.Code != http.StatusUnauthorized || len(events) != 0 {
+		t.Errorf("expected a request signed with an empty secret to be rejected, got %v with %v events", w.Code,
+			len(events))
+	}
+	BotConfig.SigningSecret = testSigningSecret
+
+	// The rejected requests didn't mark the event as seen
+	if w := postEvent(handler, body, testSigningSecret, time.Now(), ""); w.Code != http.StatusOK || len(events) != 1 {
+		t.Errorf("expected the signed event to be passed on, got %v with %v events", w.Code, len(events))
+	}
+}
+
+func TestEventsRetriesAreHandledOnce(t *testing.T) {
+	BotConfig = &Config{SigningSecret: testSigningSecret}
+	events := make(chan slack.RTMEvent, 2)
+	handler := EventsHandler(events)
+	body := testMessageEvent
+
+	for _, retry := range []string{"", "1", "2"} {
+		if w := postEvent(handler, body, testSigningSecret, time.Now(), retry); w.Code != http.StatusOK {
+			t.Errorf("expected retry %q to be acknowledged, got %v", retry, w.Code)
+		}
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected the event to be passed on once, got %v", len(events))
+	}
+	event := <-events
+	msg, ok := event.Data.(*slack.MessageEvent)
+	if !ok || event.Type != "message" || msg.Text != "hi" || msg.User != "UALICE" {
+		t.Errorf("expected the message event, got %+v", event)
+	}
+
+	// Other events still come through
+	other := `{"type":"event_callback","event_id":"Ev2","event":{"type":"reaction_added","user":"UALICE",` +
+		`"reaction":"taco","item_user":"UBOB","item":{"type":"message","channel":"CGENERAL","ts":"1600000000.000001"}}}`
+	postEvent(handler, other, testSigningSecret, time.Now(), "")
+	if len(events) != 1 {
+		t.Fatalf("expected the second event to be passed on, got %v", len(events))
+	}
+	if reaction, ok := (<-events).Data.(*slack.ReactionAddedEvent); !ok || reaction.Reaction != "taco" {
+		t.Errorf("expected the reaction event, got %+v", reaction)
+	}
+
+	// An event which timed out was received the first time, even if it wasn't seen by this handler
+	timedOut := strings.Replace(other, "Ev2", "Ev3", 1)
+	postEvent(handler, timedOut, testSigningSecret, time.Now(), "1")
+	if len(events) != 0 {
+		t.Fatalf("expected the timed out event not to be passed on again, got %v", len(events))
+	}
+
+	// Other failures might not have reached the bot at all
+	failed := strings.Replace(other, "Ev2", "Ev4", 1)
+	postRetry(handler, failed, testSigningSecret, time.Now(), "1", "connection_failed")
+	postRetry(handler, failed, testSigningSecret, time.Now(), "2", "connection_failed")
+	if len(events) != 1 {
+		t.Fatalf("expected the failed event to be passed on once, got %v", len(events))
+	}
+}
+
+func TestEventsAreAcknowledgedWhenBusy(t *testing.T) {
+	BotConfig = &Config{SigningSecret: testSigningSecret}
+	// Nothing is reading the events yet
+	events := make(chan slack.RTMEvent)
+	handler := EventsHandler(events)
+
+	answered := make(chan int, 1)
+	go func() {
+		answered <- postEvent(handler, testMessageEvent, testSigningSecret, time.Now(), "").Code
+	}()
+	select {
+	case code := <-answered:
+		if code != http.StatusOK {
+			t.Errorf("expected the event to be acknowledged, got %v", code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the event to be acknowledged without waiting for the event loop")
+	}
+
+	// The event is still passed on once the event loop gets to it
+	select {
+	case event := <-events:
+		if _, ok := event.Data.(*slack.MessageEvent); !ok {
+			t.Errorf("expected the message event, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the event to be passed on")
+	}
+}
+
+func TestSeenEventsForgetsOldest(t *testing.T) {
+	seen := newSeenEvents(2)
+	for _, id := range []string{"Ev1", "Ev2", "Ev3"} {
+		if seen.check(id) {
+			t.Errorf("expected %v to be new", id)
+		}
+	}
+	if !seen.check("Ev3") || !seen.check("Ev2") {
+		t.Errorf("expected the most recent events to be remembered")
+	}
+	if seen.check("Ev1") {
+		t.Errorf("expected the oldest event to be forgotten")
+	}
+}
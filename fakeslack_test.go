@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/nlopes/slack"
+	"strings"
+	"sync"
+)
+
+// fakeSlack is an in-process stand-in for a Slack workspace. It implements Chat, keeping its users, channels and direct
+// message channels in memory and recording every message the bot posts.
+type fakeSlack struct {
+	mu       sync.Mutex
+	users    map[string]*slack.User
+	channels map[string]*slack.Channel
+	ims      map[string]string
+	messages []*fakeMessage
+	lastTs   int
+}
+
+// fakeMessage is a message the bot posted. Ephemeral messages are only shown to User.
+type fakeMessage struct {
+	Channel     string
+	Timestamp   string
+	Text        string
+	Attachments []slack.Attachment
+	Ephemeral   bool
+	User        string
+}
+
+func newFakeSlack() *fakeSlack {
+	return &fakeSlack{
+		users:    make(map[string]*slack.User),
+		channels: make(map[string]*slack.Channel),
+		ims:      make(map[string]string),
+	}
+}
+
+// addUser adds a member to the workspace
+func (f *fakeSlack) addUser(id string, name string, bot bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[id] = &slack.User{ID: id, Name: name, IsBot: bot}
+}
+
+// setTz changes the time zone in the user's profile
+func (f *fakeSlack) setTz(id string, tz string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[id].TZ = tz
+}
+
+// setAdmin makes the user an admin of the workspace
+func (f *fakeSlack) setAdmin(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[id].IsAdmin = true
+}
+
+// addChannel adds a public or private channel to the workspace
+func (f *fakeSlack) addChannel(id string, name string, private bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	channel := &slack.Channel{}
+	channel.ID = id
+	channel.Name = name
+	channel.IsChannel = !private
+	channel.IsPrivate = private
+	f.channels[id] = channel
+}
+
+func (f *fakeSlack) GetUserInfo(user string) (*slack.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, ok := f.users[user]
+	if !ok {
+		return nil, fmt.Errorf("user_not_found")
+	}
+	copied := *info
+	return &copied, nil
+}
+
+func (f *fakeSlack) OpenIMChannel(user string) (bool, bool, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.users[user]; !ok {
+		return false, false, "", fmt.Errorf("user_not_found")
+	}
+	if id, ok := f.ims[user]; ok {
+		return false, true, id, nil
+	}
+
+	id := "D" + user
+	f.ims[user] = id
+	channel := &slack.Channel{}
+	channel.ID = id
+	channel.IsIM = true
+	channel.User = user
+	f.channels[id] = channel
+	return false, false, id, nil
+}
+
+func (f *fakeSlack) PostMessage(channelID string, options ...slack.MsgOption) (string, string, error) {
+	endpoint, values, err := slack.UnsafeApplyMsgOptions("", channelID, options...)
+	if err != nil {
+		return "", "", err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.channels[channelID]; !ok {
+		return "", "", fmt.Errorf("channel_not_found")
+	}
+
+	f.lastTs++
+	msg := &fakeMessage{
+		Channel:   channelID,
+		Timestamp: fmt.Sprintf("%v.000100", 1500000000+f.lastTs),
+		Text:      values.Get("text"),
+		Ephemeral: strings.HasSuffix(endpoint, "chat.postEphemeral"),
+		User:      values.Get("user"),
+	}
+	if attachments := values.Get("attachments"); attachments != "" {
+		if err := json.Unmarshal([]byte(attachments), &msg.Attachments); err != nil {
+			return "", "", err
+		}
+	}
+	f.messages = append(f.messages, msg)
+	return channelID, msg.Timestamp, nil
+}
+
+func (f *fakeSlack) GetConversationInfo(channelID string, includeLocale bool) (*slack.Channel, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	channel, ok := f.channels[channelID]
+	if !ok {
+		return nil, fmt.Errorf("channel_not_found")
+	}
+	copied := *channel
+	return &copied, nil
+}
+
+// posted returns the messages posted to the channel so far
+func (f *fakeSlack) posted(channelID string) []*fakeMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result := make([]*fakeMessage, 0)
+	for _, msg := range f.messages {
+		if msg.Channel == channelID {
+			result = append(result, msg)
+		}
+	}
+	return result
+}
+
+// dms returns the text of every direct message the bot sent to the user so far
+func (f *fakeSlack) dms(user string) []string {
+	f.mu.Lock()
+	id, ok := f.ims[user]
+	f.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	result := make([]string, 0)
+	for _, msg := range f.posted(id) {
+		result = append(result, msg.Text)
+	}
+	return result
+}
+
+// reset forgets every message posted so far
+func (f *fakeSlack) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages = nil
+}
@@ -2,9 +2,11 @@ module heykudos
 
 require (
 	github.com/go-sql-driver/mysql v1.4.1
-	github.com/gorilla/websocket v1.4.0 // indirect
+	github.com/gorilla/websocket v1.4.0
+	github.com/lib/pq v1.1.1
 	github.com/lusis/go-slackbot v0.0.0-20180109053408-401027ccfef5 // indirect
 	github.com/lusis/slack-test v0.0.0-20180109053238-3c758769bfa6 // indirect
+	github.com/mattn/go-sqlite3 v1.10.0
 	github.com/nlopes/slack v0.5.0
 	github.com/pkg/errors v0.8.1
 	github.com/stretchr/testify v1.3.0 // indirect
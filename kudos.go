@@ -1,21 +1,19 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 	"github.com/nlopes/slack"
 	"log"
 	"regexp"
+	"sort"
 	"strings"
 )
 
 var (
-	pingPattern  = regexp.MustCompile("<@([a-zA-Z0-9]+)>")
+	pingPattern  = regexp.MustCompile("<@([a-zA-Z0-9]+)(?:\\|[^>]*)?>")
 	emojiPattern = regexp.MustCompile("`[^`]*`|:([a-z0-9_\\-+']+):")
 )
 
-var enabledChannels = make(map[string]bool)
-
 var (
 	BotId             string
 	EnableText        string
@@ -27,6 +25,9 @@ var (
 	HelpText          string
 	CommandText       string
 	PersonalStatsText string
+	ConfigText        string
+	AuditText         string
+	AdminText         string
 )
 
 func Init(info *slack.Info) {
@@ -35,6 +36,9 @@ func Init(info *slack.Info) {
 	DisableText = "disable"
 	LeaderboardText = "leaderboard"
 	PersonalStatsText = "stats"
+	ConfigText = "config"
+	AuditText = "audit"
+	AdminText = "admin"
 	TeamName = info.Team.Name
 	DomainText = info.Team.Domain
 	BotUsername = info.User.Name
@@ -42,10 +46,10 @@ func Init(info *slack.Info) {
 	CommandText = fmt.Sprintf("<@%v>", BotId)
 }
 
-func MessageHandler(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
-	if strings.HasPrefix(ev.Text, CommandText) {
+func MessageHandler(req *Request, api Chat, store Store) {
+	if strings.HasPrefix(req.Text, CommandText) {
 		// is a command
-		fullCommand := strings.TrimLeft(strings.TrimPrefix(ev.Text, CommandText), " \t")
+		fullCommand := strings.TrimLeft(strings.TrimPrefix(req.Text, CommandText), " \t")
 		index := strings.IndexAny(fullCommand, " \t")
 		var cmd string
 		if index == -1 {
@@ -57,129 +61,157 @@ func MessageHandler(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
 		trimmedCmd := strings.ToLower(strings.Trim(cmd, " \t"))
 
 		if len(trimmedCmd) == 0 {
-			HelpMessage(ev, rtm, db)
+			HelpMessage(req, api, store)
+			return
+		}
+
+		if requiresAdmin(trimmedCmd) && !isAdmin(req.User, api) {
+			notAdmin(req, api, trimmedCmd)
 			return
 		}
 
 		switch trimmedCmd {
 		case EnableText:
-			EnableChannel(ev, rtm, db)
+			EnableChannel(req, api, store)
 			return
 		case DisableText:
-			DisableChannel(ev, rtm, db)
+			DisableChannel(req, api, store)
 			return
 		case HelpText:
-			HelpMessage(ev, rtm, db)
+			HelpMessage(req, api, store)
+			return
+		case ConfigText:
+			ConfigureChannel(req, api, store)
+			return
+		case AuditText:
+			AuditCommand(req, api, store)
+			return
+		case AdminText:
+			AdminCommand(req, api, store)
 			return
 		}
 
-		if !checkChannelEnabled(ev.Channel, db) {
+		if !checkChannelEnabled(req.Channel, store) {
+			channelNotEnabled(req, api)
 			return
 		}
 
 		switch trimmedCmd {
 		case LeaderboardText:
-			leaderboard(ev, rtm, db)
+			leaderboard(req, api, store)
 		case PersonalStatsText:
-			PersonalStats(ev, rtm, db)
+			PersonalStats(req, api, store)
 		default:
-			HelpMessage(ev, rtm, db)
+			HelpMessage(req, api, store)
 			return
 		}
 	} else {
-		if !checkChannelEnabled(ev.Channel, db) {
+		if !checkChannelEnabled(req.Channel, store) {
+			channelNotEnabled(req, api)
 			return
 		}
 
-		giveKudos(ev, rtm, db)
+		giveKudos(req, api, store)
 	}
 }
 
-func EnableChannel(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
-	conversation, err := rtm.GetConversationInfo(ev.Channel, true)
-	if err != nil {
-		log.Printf("Failed to get channel info for %v\n: %v", ev.Channel, err)
-		return
+// isCommand determines if the word is the name of one of the bot's commands
+func isCommand(word string) bool {
+	switch strings.ToLower(word) {
+	case EnableText, DisableText, HelpText, LeaderboardText, PersonalStatsText, ConfigText, AuditText, AdminText:
+		return true
 	}
+	return false
+}
 
-	if conversation.IsIM || conversation.IsMpIM {
-		log.Printf("Not enabling %v, not a normal channel\n", ev.Channel)
-		user, err := GetUser(ev.User, rtm, db)
-		if err != nil {
-			return // give up
-		}
-		SendMessage(user, "Sorry, you're only allowed to enable normal channels", rtm)
+// channelNotEnabled lets slash command users know why nothing happened. Messages in channels that aren't enabled are
+// silently ignored, since the bot sees every message in the channels it's in.
+func channelNotEnabled(req *Request, api Chat) {
+	if req.ResponseURL == "" {
 		return
 	}
+	err := req.Reply(api, true, "HeyKudos isn't enabled in this channel, an admin can enable it with `/kudos enable`.")
+	if err != nil {
+		log.Printf("Error while responding to command in %v: %v\n", req.Channel, err)
+	}
+}
 
-	log.Printf("Enabling channel %v\n", ev.Channel)
-	enabledChannels[ev.Channel] = true
-	rows, err := db.Query(`
-		INSERT INTO enabled_channels (name, enabled)
-		VALUES (?, TRUE)
-		ON DUPLICATE KEY UPDATE
-			enabled = TRUE
-	`, ev.Channel)
-
+func EnableChannel(req *Request, api Chat, store Store) {
+	conversation, err := api.GetConversationInfo(req.Channel, true)
 	if err != nil {
-		log.Printf("Failed to enable channel %v: %v\n", ev.Channel, err)
+		log.Printf("Failed to get channel info for %v\n: %v", req.Channel, err)
 		return
 	}
-	CloseRows(rows)
 
-	user, err := GetUser(ev.User, rtm, db)
+	if conversation.IsIM || conversation.IsMpIM {
+		log.Printf("Not enabling %v, not a normal channel\n", req.Channel)
+		replyConfig(req, api, "Sorry, you're only allowed to enable normal channels")
+		return
+	}
+
+	log.Printf("Enabling channel %v\n", req.Channel)
+	err = store.SetChannelEnabled(req.Channel, true)
+
 	if err != nil {
+		log.Printf("Failed to enable channel %v: %v\n", req.Channel, err)
 		return
 	}
+	channelSettings.Delete(req.Channel)
 
 	if conversation.IsPrivate {
-		SendMessage(user, fmt.Sprintf("Enabled private channel #%v", conversation.Name), rtm)
+		replyConfig(req, api, fmt.Sprintf("Enabled private channel #%v", conversation.Name))
 	} else {
-		SendMessage(user, fmt.Sprintf("Enabled channel <#%v>", ev.Channel), rtm)
+		replyConfig(req, api, fmt.Sprintf("Enabled channel <#%v>", req.Channel))
 	}
 }
 
-func DisableChannel(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
-	log.Printf("Disabling channel %v\n", ev.Channel)
-	enabledChannels[ev.Channel] = false
-	rows, err := db.Query("UPDATE enabled_channels SET enabled = FALSE WHERE name = ?", ev.Channel)
-	if err != nil {
-		log.Printf("Failed to disable channel %v: %v\n", ev.Channel, err)
-		return
-	}
-	CloseRows(rows)
-
-	user, err := GetUser(ev.User, rtm, db)
+func DisableChannel(req *Request, api Chat, store Store) {
+	log.Printf("Disabling channel %v\n", req.Channel)
+	err := store.SetChannelEnabled(req.Channel, false)
 	if err != nil {
+		log.Printf("Failed to disable channel %v: %v\n", req.Channel, err)
 		return
 	}
+	channelSettings.Delete(req.Channel)
 
-	conversation, err := rtm.GetConversationInfo(ev.Channel, true)
+	conversation, err := api.GetConversationInfo(req.Channel, true)
 	if err != nil {
 		return
 	}
 
 	if conversation.IsPrivate {
-		SendMessage(user, fmt.Sprintf("Disabled private channel #%v", conversation.Name), rtm)
+		replyConfig(req, api, fmt.Sprintf("Disabled private channel #%v", conversation.Name))
 	} else {
-		SendMessage(user, fmt.Sprintf("Disabled channel <#%v>", ev.Channel), rtm)
+		replyConfig(req, api, fmt.Sprintf("Disabled channel <#%v>", req.Channel))
 	}
 }
 
 type UserCount struct {
 	Username string
-	Count    int
+	Points   int
 }
 
-func leaderboard(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
+func leaderboard(req *Request, api Chat, store Store) {
 	// Find emojis to specify for leaderboard
-	emojis := EmojiMatch(ev)
+	emojis := EmojiMatch(req)
 
-	rcvBoard := genLeaderboard(db, emojis, true)
+	user, err := GetUser(req.User, api, store)
+	if err != nil {
+		log.Printf("Failed to get info for user %v: %v\n", req.User, err)
+		return
+	}
+
+	window, err := WindowMatch(req, user)
+	if err != nil {
+		invalidWindow(user, api, err)
+		return
+	}
+
+	rcvBoard := genLeaderboard(store, emojis, window, true)
 	if rcvBoard == nil {
 		return
 	}
-	gvnBoard := genLeaderboard(db, emojis, false)
+	gvnBoard := genLeaderboard(store, emojis, window, false)
 	if gvnBoard == nil {
 		return
 	}
@@ -188,65 +220,25 @@ func leaderboard(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
 		*gvnBoard,
 	}
 
-	_, _, err := rtm.PostMessage(ev.Channel, slack.MsgOptionUsername(BotUsername), slack.MsgOptionAttachments(attachments...))
+	err = req.Reply(api, false, "", attachments...)
 
 	if err != nil {
-		log.Printf("Error while sending message to %v: %v\n", ev.Channel, err)
+		log.Printf("Error while sending message to %v: %v\n", req.Channel, err)
 	}
 }
 
-func genLeaderboard(db *sql.DB, emojis []string, receiveBoard bool) *slack.Attachment {
-	var rows *sql.Rows
-	var err error
-
-	var target string
-	if receiveBoard {
-		target = "k.recipient"
-	} else {
-		target = "k.sender"
-	}
-
-	if len(emojis) == 0 {
-		// sum all emojis when not specified
-		rows, err = db.Query(fmt.Sprintf(`
-			SELECT u.username, SUM(k.count)
-			FROM kudos k
-				INNER JOIN users u ON %v = u.id
-			GROUP BY u.username
-			ORDER BY SUM(k.count) DESC, u.username DESC
-			LIMIT 10
-		`, target))
-	} else {
-		rows, err = db.Query(fmt.Sprintf(`
-			SELECT u.username, SUM(k.count)
-			FROM kudos k
-				INNER JOIN users u ON %v = u.id
-			WHERE k.emoji IN (%v)
-			GROUP BY u.username
-			ORDER BY SUM(k.count) DESC, u.username DESC
-			LIMIT 10
-		`, target, createParams(emojis)), generify(emojis)...)
-	}
+// invalidWindow lets the user know the time window in their command couldn't be understood
+func invalidWindow(user *User, api Chat, err error) {
+	SendMessage(user, fmt.Sprintf("Sorry, I couldn't understand that time range: %v", err), api)
+}
 
+func genLeaderboard(store Store, emojis []string, window *TimeWindow, receiveBoard bool) *slack.Attachment {
+	userCounts, err := store.Leaderboard(expandEmojiAliases(emojis), window, receiveBoard)
 	if err != nil {
 		log.Printf("Error while querying for leaderboard: %v\n", err)
 		return nil
 	}
 
-	defer CloseRows(rows)
-
-	userCounts := make([]*UserCount, 0, 10)
-	for rows.Next() {
-		userCount := UserCount{}
-		err = rows.Scan(&userCount.Username, &userCount.Count)
-		if err != nil {
-			log.Printf("Failed to get user count data: %v\n", err)
-			return nil
-		}
-
-		userCounts = append(userCounts, &userCount)
-	}
-
 	sb := strings.Builder{}
 	if len(emojis) == 0 {
 		sb.WriteString("all")
@@ -258,6 +250,10 @@ func genLeaderboard(db *sql.DB, emojis []string, receiveBoard bool) *slack.Attac
 			sb.WriteString(fmt.Sprintf(":%v:", text))
 		}
 	}
+	if window != nil {
+		sb.WriteString(", ")
+		sb.WriteString(window.Name)
+	}
 
 	var title string
 	if receiveBoard {
@@ -282,7 +278,7 @@ func formatLeaderboardCounts(userCounts []*UserCount) string {
 		if i != 0 {
 			builder.WriteString("\n")
 		}
-		builder.WriteString(fmt.Sprintf("%v. `%v` `%v`", i+1, userCount.Username, userCount.Count))
+		builder.WriteString(fmt.Sprintf("%v. `%v` `%v`", i+1, userCount.Username, userCount.Points))
 	}
 
 	return builder.String()
@@ -290,20 +286,20 @@ func formatLeaderboardCounts(userCounts []*UserCount) string {
 
 // giveKudos first checks if the message should give kudos. Messages without a pinged user (recipient) and messages
 // without any emojis are not kudos messages. This function assumes the channel has already been validated as enabled.
-func giveKudos(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
-	emojis := emojiPattern.FindAllStringSubmatch(ev.Text, -1)
+func giveKudos(req *Request, api Chat, store Store) {
+	emojis := emojiPattern.FindAllStringSubmatch(req.Text, -1)
 	if len(emojis) == 0 {
 		return
 	}
 
-	// Throw out emojis which aren't actually emojis
+	// Throw out emojis which aren't actually emojis, and count the rest under their canonical names
 	validEmojis := make([]string, 0, len(emojis))
 	for _, emoji := range emojis {
 		if len(emoji) != 2 {
 			continue
 		}
-		if isEmoji(emoji[1]) {
-			validEmojis = append(validEmojis, emoji[1])
+		if canonical, ok := canonicalEmoji(emoji[1]); ok {
+			validEmojis = append(validEmojis, canonical)
 		}
 	}
 
@@ -312,18 +308,30 @@ func giveKudos(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
 	}
 
 	// Find all pinged names
-	names := flatten(pingPattern.FindAllStringSubmatch(ev.Text, -1), 1)
+	names := flatten(pingPattern.FindAllStringSubmatch(req.Text, -1), 1)
 	if names == nil {
 		return
 	}
 
+	// The channel can limit which emojis count as kudos
+	settings := getChannelSettings(req.Channel, store)
+	if settings == nil {
+		return
+	}
+	allowedEmojis := make([]string, 0, len(validEmojis))
+	for _, emoji := range validEmojis {
+		if settings.allowsEmoji(emoji) {
+			allowedEmojis = append(allowedEmojis, emoji)
+		}
+	}
+
 	// Prevent duplicate pings from spamming
 	names = unique(names)
 
 	// Find sender, should always succeed
-	from, err := GetUser(ev.User, rtm, db)
+	from, err := GetUser(req.User, api, store)
 	if err != nil {
-		log.Printf("Failed to get info for user %v: %v\n", ev.Username, err)
+		log.Printf("Failed to get info for user %v: %v\n", req.Username, err)
 		return
 	}
 
@@ -331,13 +339,13 @@ func giveKudos(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
 	// Not all have to work (_technically_ not necessary, but matching that format is unlikely on accident)
 	toSlice := make([]*User, 0, len(names))
 	for _, name := range names {
-		to, err := GetUser(name, rtm, db)
+		to, err := GetUser(name, api, store)
 		if err != nil {
 			// This doesn't really have to be a username
 			continue
 		}
 		if to.Id == from.Id {
-			SendMessage(from, "Sorry, but you can't give yourself kudos!", rtm)
+			SendMessage(from, "Sorry, but you can't give yourself kudos!", api)
 			return
 		}
 		toSlice = append(toSlice, to)
@@ -348,147 +356,72 @@ func giveKudos(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
 		return
 	}
 
+	if len(allowedEmojis) == 0 {
+		SendMessage(from, fmt.Sprintf("Sorry, but only %v can be given as kudos in this channel.",
+			formatEmojiList(settings.Emojis)), api)
+		return
+	}
+	validEmojis = allowedEmojis
+
 	if len(toSlice) > 1 && len(validEmojis) > 1 && len(toSlice) != len(validEmojis) {
 		SendMessage(from, fmt.Sprintf("Sorry, but I couldn't figure out how to give your kudos. You listed "+
 			"more than one recipient and more than one emoji, but the number of each doesn't match! I saw `%v` "+
-			"recipients and `%v` emojis.", len(toSlice), len(validEmojis)), rtm)
+			"recipients and `%v` emojis.", len(toSlice), len(validEmojis)), api)
 		SendMessage(from, "You can list only one emoji which will go to everyone, or multiple emojis to go "+
-			"to one person. But multiple emojis to multiple people have to match counts!", rtm)
-		return
-	}
-
-	left := checkRateLimit(from, toSlice, validEmojis, db, rtm)
-	if left < 0 {
+			"to one person. But multiple emojis to multiple people have to match counts!", api)
 		return
 	}
 
+	gifts := make([]*Gift, 0, len(toSlice))
 	if len(toSlice) > 1 {
 		// Multiple names, match emojis to names (if multiple emojis are listed)
 		for i, to := range toSlice {
 			if len(validEmojis) > 1 {
-				GiveKudos(from, to, db, rtm, ev, left, validEmojis[i])
+				gifts = append(gifts, &Gift{To: to, Emojis: validEmojis[i : i+1]})
 			} else {
-				GiveKudos(from, to, db, rtm, ev, left, validEmojis[0])
+				gifts = append(gifts, &Gift{To: to, Emojis: validEmojis[:1]})
 			}
 		}
 	} else {
 		// Single name, give all emojis listed
-		GiveKudos(from, toSlice[0], db, rtm, ev, left, validEmojis...)
-	}
-}
-
-// checkChannelEnabled determines if a particular channel is enabled (turned on with @heykudos enable). The state is
-// stored in the database, but an in-memory cache `enabledChannels` is used after initial reads.
-func checkChannelEnabled(channelName string, db *sql.DB) bool {
-	val, ok := enabledChannels[channelName]
-	if ok {
-		return val
+		gifts = append(gifts, &Gift{To: toSlice[0], Emojis: validEmojis})
 	}
 
-	rows, err := db.Query("SELECT enabled FROM enabled_channels WHERE name = ?", channelName)
-	if err != nil {
-		log.Printf("Error while querying enabled_channels: %v\n", err)
-		return false
-	}
-	defer func(rows *sql.Rows) {
-		_ = rows.Close()
-	}(rows)
-
-	var enabled bool
-	if rows.Next() {
-		err = rows.Scan(&enabled)
-		if err != nil {
-			log.Printf("Error while scanning query result: %v\n", err)
-			return false
-		}
-	}
-
-	enabledChannels[channelName] = enabled
-	return enabled
+	GiveKudos(from, gifts, store, api, req.Channel, req.Msg.Timestamp)
 }
 
-func checkRateLimit(from *User, toSlice []*User, validEmojis []string, db *sql.DB, rtm *slack.RTM) int {
-	// Figure out how many they want to give vs how many they can give at this point
-	var give int
-	if len(toSlice) > 1 {
-		give = len(toSlice)
-	} else {
-		give = len(validEmojis)
-	}
-
-	// Remove old entries to reset for the day
-	rows, err := db.Query(`DELETE FROM rate WHERE time < CURRENT_DATE()`)
-	if err != nil {
-		log.Printf("Failed to remove old kudos: %v\n", err)
-		return -1
-	}
-	CloseRows(rows)
-
-	// Count total for today
-	rows, err = db.Query(`
-		SELECT coalesce(r.count, 0)
-		FROM rate r
-		WHERE r.user_id = ?
-`, from.Id)
-	if err != nil {
-		log.Printf("Failed to query for rate limits: %v\n", err)
-		return -1
+// rateLimited lets the sender know their kudos weren't given because they don't have enough of their allowance left,
+// and when they can give more
+func rateLimited(from *User, limit *AllowanceError, allowance *Allowance, policy AllowancePolicy, where string, api Chat) {
+	log.Printf("%v rate limited\n", from.Username)
+	if limit.Used >= limit.Limit {
+		SendMessage(from, fmt.Sprintf("Sorry, you're out of kudos to give for now. You can only give %v%v. %v",
+			policy.Per(allowance.Limit), where, policy.Resets(allowance)), api)
+		return
 	}
-	defer CloseRows(rows)
+	SendMessage(from, fmt.Sprintf("Sorry, you tried to give %v kudos, but you only have %v kudos left to give %v%v. %v",
+		limit.Requested, limit.Limit-limit.Used, policy.Period(), where, policy.Resets(allowance)), api)
+}
 
-	var count int
-	if rows.Next() {
-		err = rows.Scan(&count)
-		if err != nil {
-			log.Printf("Failed to get rate limit count: %v\n", err)
-			return -1
-		}
-	} else {
-		count = 0
-	}
-
-	switch {
-	case count >= BotConfig.AmountPerDay:
-		log.Printf("%v rate limited\n", from.Username)
-		message := fmt.Sprintf("Sorry, you're out of kudos to give for now. You can only give %v every 24 hours.", BotConfig.AmountPerDay)
-		SendMessage(from, message, rtm)
-		return -1
-	case (count + give) > BotConfig.AmountPerDay:
-		log.Printf("%v rate limited\n", from.Username)
-		message := fmt.Sprintf("Sorry, you tried to give %v kudos, but you only have %v kudos left to give today.", give, BotConfig.AmountPerDay-count)
-		SendMessage(from, message, rtm)
-		return -1
-	}
-
-	rows, err = db.Query(`
-		INSERT INTO rate (user_id, count) VALUES (?, ?)
-		ON DUPLICATE KEY UPDATE
-			count = count + ?
-	`, from.Id, give, give)
-	if err != nil {
-		log.Printf("Failed to insert into rate limit table: %v\n", err)
-		return -1
+// formatEmojiList writes out the emojis as they'd be typed, such as ":taco:, :star:"
+func formatEmojiList(emojis []string) string {
+	formatted := make([]string, len(emojis))
+	for i, emoji := range emojis {
+		formatted[i] = fmt.Sprintf(":%v:", emoji)
 	}
-	CloseRows(rows)
-
-	return BotConfig.AmountPerDay - (count + give)
+	return strings.Join(formatted, ", ")
 }
 
 //helpMessage added 2-21-19
-func HelpMessage(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
-	//Get user that requested help
-	helpUser, err := GetUser(ev.User, rtm, db)
-	if err != nil {
-		log.Printf("Failed to get info for user %v: %v\n", ev.Username, err)
-		return
-	}
-
+func HelpMessage(req *Request, api Chat, store Store) {
 	helpString := "heykudos is a bot used to recognize someone for being awesome!\n" +
 
 		"If you want to send someone a kudos simply @ them and send them an emoji. Any emoji will work!\n" +
 
 		">`@username` :rainbow:\n" +
 
+		"Reacting to someone's message with an emoji gives them kudos too.\n" +
+
 		"You can send a message along too if you like:\n" +
 		">`@username` :rainbow: for being the best bot on slack!\n" +
 
@@ -504,25 +437,61 @@ func HelpMessage(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
 		"Or a leaderboard for particular emojis:\n" +
 		">`@heykudos` leaderboard :rainbow: :taco:\n" +
 
+		"Leaderboards and stats can be limited to a period of time as well:\n" +
+		">`@heykudos` leaderboard week :taco:\n" +
+		">`@heykudos` stats since 2019-01-01\n" +
+		">You can use `today`, `week`, `month`, `quarter`, `year`, `since <date>`, `until <date>` or `<date> to <date>`.\n" +
+
 		"You can see a breakdown of all the kudos you've given and received:\n" +
 		"> `@heykudos` stats\n" +
 
 		"Or a breakdown for specific emojis you've given and received:\n" +
 		"> `@heykudos` stats :rainbow: :taco:\n" +
 
-		"You are limited to 5 kudos per day to send, but you can receive an unlimited amount of kudos!"
+		"All of these commands also work as slash commands, such as `/kudos leaderboard` or `/kudos @username :rainbow:`\n" +
+
+		"Each channel can have its own daily allowance, a list of the only emojis that count, and public announcements of kudos:\n" +
+		">`@heykudos` config\n" +
+		">`@heykudos` config allowance 3\n" +
+		">`@heykudos` config emojis :taco: :star:\n" +
+		">`@heykudos` config announce on\n" +
+		">`@heykudos` audit reciprocity\n" +
+		">`@heykudos` admin log\n" +
+		">Only HeyKudos admins can enable or disable channels, change their settings, run audits or use `admin`.\n" +
+
+		BotConfig.Policy().Help()
+
+	if len(BotConfig.EmojiWeights) != 0 {
+		helpString += "\nSome emojis are worth more than one kudos, and use up that many from your allowance:\n" +
+			formatEmojiWeights(BotConfig.EmojiWeights)
+	}
 
 	//Post an ephemeral message to same channel the help request was made from
-	_, _, err = rtm.PostMessage(
-		ev.Channel,
-		slack.MsgOptionUsername(BotUsername),
-		slack.MsgOptionPostEphemeral(helpUser.SlackId),
-		slack.MsgOptionText(helpString, false),
-	)
+	err := req.Reply(api, true, helpString)
 
 	//if an error occurs log it
 	if err != nil {
-		log.Printf("Error while sending message to %v: %v\n", ev.Channel, err)
+		log.Printf("Error while sending message to %v: %v\n", req.Channel, err)
 	}
 
 }
+
+// formatEmojiWeights lists how many points each weighted emoji is worth, such as ">:trophy: `5`", ordered by weight
+func formatEmojiWeights(weights map[string]int) string {
+	emojis := make([]string, 0, len(weights))
+	for emoji := range weights {
+		emojis = append(emojis, emoji)
+	}
+	sort.Slice(emojis, func(i, j int) bool {
+		if weights[emojis[i]] != weights[emojis[j]] {
+			return weights[emojis[i]] > weights[emojis[j]]
+		}
+		return emojis[i] < emojis[j]
+	})
+
+	lines := make([]string, len(emojis))
+	for i, emoji := range emojis {
+		lines[i] = fmt.Sprintf(">:%v: `%v`", emoji, BotConfig.EmojiWeight(emoji))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nlopes/slack"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testBot is the bot running against a fake workspace and a fresh SQLite database
+type testBot struct {
+	t     *testing.T
+	slack *fakeSlack
+	store Store
+	ts    int64
+}
+
+// newTestBot sets up a workspace with alice, bob and carol in #general, and the bot itself
+func newTestBot(t *testing.T) *testBot {
+	store := newTestStore(t)
+
+	BotConfig = &Config{Mode: ModeRTM, AmountPerDay: 5}
+	Init(&slack.Info{
+		User: &slack.UserDetails{ID: "UBOT", Name: "heykudos"},
+		Team: &slack.Team{ID: "T1", Name: "Test", Domain: "test"},
+	})
+	channelSettings.Clear()
+	checkedUserTzs.Clear()
+	slackAdmins.Clear()
+
+	// Seed the emoji cache so isEmoji never has to go looking for emojis online
+	for _, name := range []string{"taco", "star", "rainbow", "heart", "+1"} {
+		emojiCache.Set(name, name)
+	}
+	emojiCache.Set("thumbsup", "+1")
+
+	fake := newFakeSlack()
+	fake.addUser("UBOT", "heykudos", true)
+	fake.addUser("UALICE", "alice", false)
+	fake.setAdmin("UALICE")
+	fake.addUser("UBOB", "bob", false)
+	fake.addUser("UCAROL", "carol", false)
+	fake.addChannel("CGENERAL", "general", false)
+	fake.addChannel("GSECRET", "secret", true)
+
+	return &testBot{t: t, slack: fake, store: store}
+}
+
+// say has the user send the message to the channel, handling it the same way as one received from Slack
+func (b *testBot) say(user string, channel string, text string) {
+	ts := atomic.AddInt64(&b.ts, 1)
+	MessageHandler(&Request{
+		MessageEvent: &slack.MessageEvent{
+			Msg: slack.Msg{
+				Type:      "message",
+				Channel:   channel,
+				User:      user,
+				Text:      text,
+				Timestamp: fmt.Sprintf("1600000000.%06d", ts),
+			},
+		},
+	}, b.slack, b.store)
+}
+
+// ageGrants moves every grant back to the given time. The time is written in the server's time zone and bound the
+// same way the store binds it, just like the store writes the times of new grants.
+func (b *testBot) ageGrants(at time.Time) {
+	b.t.Helper()
+	s := b.store.(*sqlStore)
+	if _, err := s.exec(s.db, "UPDATE kudos_grants SET created_at = ?", at.Local()); err != nil {
+		b.t.Fatalf("failed to age the kudos: %v", err)
+	}
+}
+
+// expectDM fails the test unless the user got a direct message containing the text
+func (b *testBot) expectDM(user string, text string) {
+	b.t.Helper()
+	dms := b.slack.dms(user)
+	for _, dm := range dms {
+		if strings.Contains(dm, text) {
+			return
+		}
+	}
+	b.t.Errorf("expected %v to get a DM containing %q, got %q", user, text, dms)
+}
+
+// expectReply fails the test unless the last message in the channel was a reply with the text only shown to the user
+func (b *testBot) expectReply(user string, channel string, text string) {
+	b.t.Helper()
+	posted := b.slack.posted(channel)
+	if len(posted) == 0 {
+		b.t.Errorf("expected a reply to %v in %v, got none", user, channel)
+		return
+	}
+	if last := posted[len(posted)-1]; !last.Ephemeral || last.User != user || last.Text != text {
+		b.t.Errorf("expected an ephemeral reply to %v with %q, got %+v", user, text, last)
+	}
+}
+
+// expectNoDMs fails the test if the user got any direct messages
+func (b *testBot) expectNoDMs(user string) {
+	b.t.Helper()
+	if dms := b.slack.dms(user); len(dms) != 0 {
+		b.t.Errorf("expected no DMs for %v, got %q", user, dms)
+	}
+}
+
+// received sums the kudos the user has received
+func (b *testBot) received(slackId string) int {
+	b.t.Helper()
+	user, err := b.store.UserBySlackId(slackId)
+	if err != nil {
+		b.t.Fatalf("failed to get user %v: %v", slackId, err)
+	}
+	if user == nil {
+		return 0
+	}
+	rows, err := b.store.Stats(user.Id, nil, nil, true)
+	if err != nil {
+		b.t.Fatalf("failed to get stats for %v: %v", slackId, err)
+	}
+	total := 0
+	for _, row := range rows {
+		total += row.Count
+	}
+	return total
+}
+
+func TestGiveKudos(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.expectReply("UALICE", "CGENERAL", "Enabled channel <#CGENERAL>")
+	bot.slack.reset()
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :star: for fixing the build")
+
+	bot.expectDM("UALICE", "You just sent the following kudos to `bob`")
+	bot.expectDM("UALICE", "You have 2 kudos left to give today.")
+	bot.expectDM("UBOB", "You just received kudos")
+	bot.expectDM("UBOB", ":taco:: `2`")
+	bot.expectDM("UBOB", "https://test.slack.com/archives/CGENERAL/p1600000000000002")
+	if got := bot.received("UBOB"); got != 3 {
+		t.Errorf("expected bob to have received 3 kudos, got %v", got)
+	}
+}
+
+func TestGiveKudosToSeveralUsers(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> <@UCAROL> :rainbow:")
+	if got := bot.received("UBOB"); got != 1 {
+		t.Errorf("expected bob to have received 1 kudos, got %v", got)
+	}
+	if got := bot.received("UCAROL"); got != 1 {
+		t.Errorf("expected carol to have received 1 kudos, got %v", got)
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> <@UCAROL> :rainbow: :heart: :taco:")
+	bot.expectDM("UALICE", "the number of each doesn't match")
+	if got := bot.received("UBOB"); got != 1 {
+		t.Errorf("expected bob's kudos to be unchanged, got %v", got)
+	}
+}
+
+func TestGiveKudosToSelf(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	bot.say("UALICE", "CGENERAL", "<@UALICE> :taco:")
+	bot.expectDM("UALICE", "you can't give yourself kudos")
+	if got := bot.received("UALICE"); got != 0 {
+		t.Errorf("expected alice to have received no kudos, got %v", got)
+	}
+}
+
+func TestIgnoresMessagesWithoutKudos(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.slack.reset()
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> thanks!")
+	bot.say("UALICE", "CGENERAL", "lunch? :taco:")
+	bot.say("UALICE", "CGENERAL", "<@UNOBODY> :taco:")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> `:taco:`")
+
+	bot.expectNoDMs("UALICE")
+	bot.expectNoDMs("UBOB")
+}
+
+func TestRateLimit(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.AmountPerDay = 3
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco: :taco:")
+	bot.expectDM("UALICE", "you tried to give 4 kudos, but you only have 3 kudos left to give today")
+	if got := bot.received("UBOB"); got != 0 {
+		t.Errorf("expected bob to have received no kudos, got %v", got)
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco:")
+	bot.expectDM("UALICE", "You don't have any kudos left to give today.")
+
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :star:")
+	bot.expectDM("UALICE", "you're out of kudos to give for now")
+	if got := bot.received("UBOB"); got != 3 {
+		t.Errorf("expected bob to have received 3 kudos, got %v", got)
+	}
+
+	// Everyone has their own allowance
+	bot.say("UCAROL", "CGENERAL", "<@UBOB> :star:")
+	if got := bot.received("UBOB"); got != 4 {
+		t.Errorf("expected bob to have received 4 kudos, got %v", got)
+	}
+}
+
+func TestEnableDisable(t *testing.T) {
+	bot := newTestBot(t)
+
+	// Nothing happens in channels which aren't enabled
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	bot.expectNoDMs("UALICE")
+	bot.expectNoDMs("UBOB")
+	bot.say("UALICE", "CGENERAL", "<@UBOT> leaderboard")
+	if posted := bot.slack.posted("CGENERAL"); len(posted) != 0 {
+		t.Errorf("expected no leaderboard in a channel which isn't enabled, got %v messages", len(posted))
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.expectReply("UALICE", "CGENERAL", "Enabled channel <#CGENERAL>")
+	if settings, err := bot.store.ChannelSettings("CGENERAL"); err != nil || !settings.Enabled {
+		t.Errorf("expected #general to be stored as enabled, got %+v (%v)", settings, err)
+	}
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	if got := bot.received("UBOB"); got != 1 {
+		t.Errorf("expected bob to have received 1 kudos, got %v", got)
+	}
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT> disable")
+	bot.expectReply("UALICE", "CGENERAL", "Disabled channel <#CGENERAL>")
+	if settings, err := bot.store.ChannelSettings("CGENERAL"); err != nil || settings.Enabled {
+		t.Errorf("expected #general to be stored as disabled, got %+v (%v)", settings, err)
+	}
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	if got := bot.received("UBOB"); got != 1 {
+		t.Errorf("expected bob's kudos to be unchanged, got %v", got)
+	}
+
+	bot.say("UALICE", "GSECRET", "<@UBOT> enable")
+	bot.expectReply("UALICE", "GSECRET", "Enabled private channel #secret")
+
+	// Direct messages can't be enabled
+	_, _, im, _ := bot.slack.OpenIMChannel("UALICE")
+	bot.say("UALICE", im, "<@UBOT> enable")
+	bot.expectReply("UALICE", im, "Sorry, you're only allowed to enable normal channels")
+}
+
+func TestLeaderboard(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.slack.reset()
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco:")
+	bot.say("UALICE", "CGENERAL", "<@UCAROL> :star:")
+	bot.say("UCAROL", "CGENERAL", "<@UBOB> :star:")
+
+	bot.say("UBOB", "CGENERAL", "<@UBOT> leaderboard")
+	posted := bot.slack.posted("CGENERAL")
+	if len(posted) != 1 || len(posted[0].Attachments) != 2 {
+		t.Fatalf("expected a leaderboard with two attachments, got %+v", posted)
+	}
+	received, given := posted[0].Attachments[0], posted[0].Attachments[1]
+	if received.Pretext != "Test Received Leaderboard (all)" {
+		t.Errorf("unexpected received pretext %q", received.Pretext)
+	}
+	if received.Text != "1. `bob` `3`\n2. `carol` `1`" {
+		t.Errorf("unexpected received leaderboard %q", received.Text)
+	}
+	if given.Text != "1. `alice` `3`\n2. `carol` `1`" {
+		t.Errorf("unexpected given leaderboard %q", given.Text)
+	}
+
+	bot.slack.reset()
+	bot.say("UBOB", "CGENERAL", "<@UBOT> leaderboard :star: week")
+	posted = bot.slack.posted("CGENERAL")
+	if len(posted) != 1 || len(posted[0].Attachments) != 2 {
+		t.Fatalf("expected a leaderboard with two attachments, got %+v", posted)
+	}
+	received = posted[0].Attachments[0]
+	if !strings.HasPrefix(received.Pretext, "Test Received Leaderboard (:star:, ") {
+		t.Errorf("unexpected received pretext %q", received.Pretext)
+	}
+	if received.Text != "1. `carol` `1`\n2. `bob` `1`" {
+		t.Errorf("unexpected received leaderboard %q", received.Text)
+	}
+}
+
+func TestPersonalStats(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :star:")
+	bot.say("UCAROL", "CGENERAL", "<@UBOB> :star:")
+	bot.slack.reset()
+
+	bot.say("UBOB", "CGENERAL", "<@UBOT> stats")
+	posted := bot.slack.posted("CGENERAL")
+	if len(posted) != 1 || len(posted[0].Attachments) != 2 {
+		t.Fatalf("expected stats with two attachments, got %+v", posted)
+	}
+	if !posted[0].Ephemeral || posted[0].User != "UBOB" {
+		t.Errorf("expected stats to only be shown to bob, got %+v", posted[0])
+	}
+	received := posted[0].Attachments[0]
+	if received.Pretext != "Test My Received Kudos (all)" {
+		t.Errorf("unexpected received pretext %q", received.Pretext)
+	}
+	expected := "Total Points: `4`\n1. `alice`: `3`\n\t:taco:: `2`\n\t:star:: `1`\n2. `carol`: `1`\n\t:star:: `1`"
+	if received.Text != expected {
+		t.Errorf("unexpected received stats %q, expected %q", received.Text, expected)
+	}
+
+	bot.slack.reset()
+	bot.say("UBOB", "CGENERAL", "<@UBOT> stats :taco:")
+	posted = bot.slack.posted("CGENERAL")
+	if len(posted) != 1 || len(posted[0].Attachments) != 2 {
+		t.Fatalf("expected stats with two attachments, got %+v", posted)
+	}
+	if got := posted[0].Attachments[0].Text; got != "Total Points: `2`\n1. `alice`: `2`\n\t:taco:: `2`" {
+		t.Errorf("unexpected received stats %q", got)
+	}
+}
+
+func TestWeightedEmojis(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.EmojiWeights = map[string]int{"star": 3}
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.slack.reset()
+
+	// A star uses up 3 of the 5 kudos alice can give a day
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :star: :star:")
+	bot.expectDM("UALICE", "you tried to give 6 kudos, but you only have 5 kudos left to give today")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :star: :taco:")
+	bot.expectDM("UALICE", "You have 1 kudos left to give today.")
+	bot.say("UCAROL", "CGENERAL", "<@UBOB> :taco: :taco:")
+
+	bot.say("UBOB", "CGENERAL", "<@UBOT> leaderboard")
+	posted := bot.slack.posted("CGENERAL")
+	if len(posted) != 1 || len(posted[0].Attachments) != 2 {
+		t.Fatalf("expected a leaderboard with two attachments, got %+v", posted)
+	}
+	if got := posted[0].Attachments[0].Text; got != "1. `bob` `6`" {
+		t.Errorf("unexpected received leaderboard %q", got)
+	}
+	if got := posted[0].Attachments[1].Text; got != "1. `alice` `4`\n2. `carol` `2`" {
+		t.Errorf("unexpected given leaderboard %q", got)
+	}
+
+	bot.slack.reset()
+	bot.say("UBOB", "CGENERAL", "<@UBOT> stats")
+	posted = bot.slack.posted("CGENERAL")
+	if len(posted) != 1 || len(posted[0].Attachments) != 2 {
+		t.Fatalf("expected stats with two attachments, got %+v", posted)
+	}
+	expected := "Total Points: `6`\n1. `alice`: `4`\n\t:star:: `1` (`3` points)\n\t:taco:: `1`\n2. `carol`: `2`\n\t:taco:: `2`"
+	if got := posted[0].Attachments[0].Text; got != expected {
+		t.Errorf("unexpected received stats %q, expected %q", got, expected)
+	}
+}
+
+func TestNormalizesEmojis(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.slack.reset()
+
+	// Aliases count as the same emoji, and skin tones aren't kudos of their own
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :thumbsup: :+1::skin-tone-3: :skin-tone-2:")
+	bot.expectDM("UBOB", "(:+1:: `2`)")
+	bot.expectDM("UALICE", "You have 3 kudos left to give today.")
+
+	bot.say("UBOB", "CGENERAL", "<@UBOT> leaderboard :thumbsup:")
+	posted := bot.slack.posted("CGENERAL")
+	if len(posted) != 1 || len(posted[0].Attachments) != 2 {
+		t.Fatalf("expected a leaderboard with two attachments, got %+v", posted)
+	}
+	if got := posted[0].Attachments[0].Pretext; got != "Test Received Leaderboard (:+1:)" {
+		t.Errorf("unexpected received pretext %q", got)
+	}
+	if got := posted[0].Attachments[0].Text; got != "1. `bob` `2`" {
+		t.Errorf("unexpected received leaderboard %q", got)
+	}
+
+	// Kudos stored under an alias before emojis were normalized are merged into the canonical emoji
+	alice, _ := bot.store.UserBySlackId("UALICE")
+	bob, _ := bot.store.UserBySlackId("UBOB")
+	err := bot.store.RecordGrant(&Grant{Sender: alice.Id, Recipient: bob.Id, Emoji: "thumbsup", Count: 1, Points: 1})
+	if err != nil {
+		t.Fatalf("failed to record grant: %v", err)
+	}
+	bot.slack.reset()
+	bot.say("UBOB", "CGENERAL", "<@UBOT> stats :+1:")
+	posted = bot.slack.posted("CGENERAL")
+	if len(posted) != 1 || len(posted[0].Attachments) != 2 {
+		t.Fatalf("expected stats with two attachments, got %+v", posted)
+	}
+	if got := posted[0].Attachments[0].Text; got != "Total Points: `3`\n1. `alice`: `3`\n\t:+1:: `3`" {
+		t.Errorf("unexpected received stats %q", got)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.slack.reset()
+
+	bot.say("UALICE", "CGENERAL", "<@UBOT>")
+	bot.say("UALICE", "CGENERAL", "<@UBOT> what")
+	posted := bot.slack.posted("CGENERAL")
+	if len(posted) != 2 {
+		t.Fatalf("expected two help messages, got %v", len(posted))
+	}
+	for _, msg := range posted {
+		if !msg.Ephemeral || !strings.HasPrefix(msg.Text, "heykudos is a bot") {
+			t.Errorf("expected an ephemeral help message, got %+v", msg)
+		}
+	}
+}
+
+func TestFailedKudosDontUseAllowance(t *testing.T) {
+	bot := newTestBot(t)
+	alice, _ := GetUser("UALICE", bot.slack, bot.store)
+	bob, _ := GetUser("UBOB", bot.slack, bot.store)
+
+	// The second grant is for a user who doesn't exist, so the whole message fails
+	allowance := &Allowance{Sender: alice.Id, Limit: 5}
+	_, err := bot.store.GiveGrants(allowance, []*Grant{
+		{Sender: alice.Id, Recipient: bob.Id, Emoji: "taco", Count: 2, Points: 2},
+		{Sender: alice.Id, Recipient: 9999, Emoji: "taco", Count: 2, Points: 2},
+	})
+	if err == nil {
+		t.Fatalf("expected giving kudos to an unknown user to fail")
+	}
+	if got := bot.received("UBOB"); got != 0 {
+		t.Errorf("expected none of the kudos to be given, bob got %v", got)
+	}
+
+	left, err := bot.store.GiveGrants(allowance, []*Grant{
+		{Sender: alice.Id, Recipient: bob.Id, Emoji: "taco", Count: 5, Points: 5},
+	})
+	if err != nil || left != 0 {
+		t.Errorf("expected the whole allowance to still be available, got %v left (%v)", left, err)
+	}
+
+	_, err = bot.store.GiveGrants(allowance, []*Grant{
+		{Sender: alice.Id, Recipient: bob.Id, Emoji: "taco", Count: 1, Points: 1},
+	})
+	if limit, ok := err.(*AllowanceError); !ok || limit.Used != 5 || limit.Requested != 1 {
+		t.Errorf("expected the allowance to be used up, got %v", err)
+	}
+}
+
+func TestAllowanceResetsInUsersTimeZone(t *testing.T) {
+	bot := newTestBot(t)
+	bot.slack.setTz("UALICE", "Asia/Tokyo")
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco: :taco: :taco:")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	resets := startOfDay(time.Now(), tokyo).AddDate(0, 0, 1)
+	bot.expectDM("UALICE", fmt.Sprintf("Your kudos reset <!date^%v^", resets.Unix()))
+	if got := bot.received("UBOB"); got != 5 {
+		t.Fatalf("expected bob to have 5 kudos, got %v", got)
+	}
+
+	// Once it's the next day in Tokyo, the allowance is available again
+	db := bot.store.(*sqlStore).db
+	yesterday := rateDay(time.Now().AddDate(0, 0, -1), tokyo)
+	if _, err := db.Exec("UPDATE rate SET time = ?", yesterday); err != nil {
+		t.Fatalf("failed to move the allowance back a day: %v", err)
+	}
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	if got := bot.received("UBOB"); got != 6 {
+		t.Errorf("expected bob to have 6 kudos, got %v", got)
+	}
+}
+
+func TestUserTimeZoneChanges(t *testing.T) {
+	bot := newTestBot(t)
+	bot.slack.setTz("UALICE", "Europe/Berlin")
+	alice, _ := GetUser("UALICE", bot.slack, bot.store)
+	if alice.Location().String() != "Europe/Berlin" {
+		t.Errorf("expected alice to be in Europe/Berlin, got %v", alice.Location())
+	}
+
+	// The profile is only checked again once the stored time zone is old
+	bot.slack.setTz("UALICE", "America/Chicago")
+	alice, _ = GetUser("UALICE", bot.slack, bot.store)
+	if alice.Tz != "Europe/Berlin" {
+		t.Errorf("expected alice's time zone not to be checked again yet, got %v", alice.Tz)
+	}
+
+	checkedUserTzs.Clear()
+	GetUser("UALICE", bot.slack, bot.store)
+	alice, _ = bot.store.UserBySlackId("UALICE")
+	if alice.Tz != "America/Chicago" {
+		t.Errorf("expected alice's new time zone to be stored, got %v", alice.Tz)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Grant is a single entry in the kudos_grants ledger. Every time kudos are given a new grant is recorded, the kudos
+// table only holds the running per-pair totals which are derived from these grants. Points is the count weighted by
+// the emoji's weight when the grant was given, so changing the weights later doesn't change past grants.
+type Grant struct {
+	Id        int64
+	Sender    int64
+	Recipient int64
+	Emoji     string
+	Count     int64
+	Points    int64
+	Channel   string
+	MessageTs string
+	CreatedAt time.Time
+	RevokedAt *time.Time
+	// ByAdmin grants were made by an admin, so they don't use up the sender's allowance
+	ByAdmin bool
+	// ChannelAllowance is set when the grant was taken from its channel's own allowance rather than the sender's
+	// global allowance
+	ChannelAllowance bool
+}
+
+// The actions admins can take on the kudos, as they're recorded in the admin log
+const (
+	// AdminGrant gives kudos from one user to another on their behalf
+	AdminGrant = "grant"
+	// AdminAdjust adds to or removes from the kudos one user has given another
+	AdminAdjust = "adjust"
+	// AdminVoid revokes a grant
+	AdminVoid = "void"
+)
+
+// AdminAction is an entry in the admin log. The before and after values are the totals of the kudos the sender had
+// given the recipient with the emoji, either side of the action.
+type AdminAction struct {
+	Id           int64
+	Admin        int64
+	Action       string
+	Sender       int64
+	Recipient    int64
+	Emoji        string
+	GrantId      int64
+	Reason       string
+	CountBefore  int64
+	CountAfter   int64
+	PointsBefore int64
+	PointsAfter  int64
+	CreatedAt    time.Time
+	// The usernames are only filled in when reading the log
+	AdminName     string
+	SenderName    string
+	RecipientName string
+}
+
+// rateDay is the calendar day the time falls on in the location, in the format the rate table records days in
+func rateDay(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02")
+}
+
+// Allowance is how many points worth of kudos a user can give, and what counts towards it. Kudos given in a channel
+// with its own allowance are counted from the grants given in that channel since Since, everywhere else shares the
+// user's daily allowance.
+type Allowance struct {
+	Sender int64
+	// Limit is how many points the sender gets each period
+	Limit int
+	// Cap is the most points the sender can save up by carrying over what they didn't use in earlier periods. Nothing
+	// carries over if it's not above Limit.
+	Cap int
+	// Channel is only set when the channel has its own allowance
+	Channel string
+	// Since is the start of the sender's current period, in their time zone
+	Since time.Time
+	// Period is how long each period is
+	Period time.Duration
+	// Rolling allowances count the kudos given since Since from the ledger, rather than from the start of a period
+	Rolling bool
+	// RecipientCaps limit how much the sender can give each recipient, on top of the allowance
+	RecipientCaps []*RecipientCap
+}
+
+// carriedOver works out how many points carry over into the current period. In the period starting on the given day
+// the sender used some of the points they had, including what they had carried over into it. Every period in between
+// adds a whole allowance, up to the cap.
+func (a *Allowance) carriedOver(day string, used int, carried int) int {
+	if a.Cap <= a.Limit || a.Period <= 0 {
+		return 0
+	}
+
+	start, err := time.ParseInLocation("2006-01-02", day, a.Since.Location())
+	if err != nil {
+		return 0
+	}
+	// Days aren't always 24 hours long, so the number of periods is rounded
+	periods := int((a.Since.Sub(start) + a.Period/2) / a.Period)
+
+	left := a.Limit + carried - used
+	if left < 0 {
+		left = 0
+	}
+	total := left + a.Limit*(periods-1)
+	if total > a.Cap-a.Limit {
+		total = a.Cap - a.Limit
+	}
+	if total < 0 {
+		return 0
+	}
+	return total
+}
+
+// RecipientCap limits how many points worth of kudos a sender can give any single recipient since the start of a period
+type RecipientCap struct {
+	// Period is what the cap is for, such as "day"
+	Period string
+	Since  time.Time
+	Limit  int
+}
+
+// Resets is when the cap's period ends, after which the sender can give the recipient more kudos
+func (c *RecipientCap) Resets() time.Time {
+	switch c.Period {
+	case "week":
+		return c.Since.AddDate(0, 0, 7)
+	case "month":
+		return c.Since.AddDate(0, 1, 0)
+	default:
+		return c.Since.AddDate(0, 0, 1)
+	}
+}
+
+// RecipientCapError is returned when kudos can't be given because the sender would give one of the recipients more
+// than one of the caps allows
+type RecipientCapError struct {
+	Recipient int64
+	Cap       *RecipientCap
+	Used      int
+	Requested int
+}
+
+func (e *RecipientCapError) Error() string {
+	return fmt.Sprintf("tried to give user %v %v points with %v of %v per %v already given", e.Recipient, e.Requested,
+		e.Used, e.Cap.Limit, e.Cap.Period)
+}
+
+// AllowanceError is returned when kudos can't be given because they would exceed the sender's allowance
+type AllowanceError struct {
+	Limit     int
+	Used      int
+	Requested int
+}
+
+func (e *AllowanceError) Error() string {
+	return fmt.Sprintf("tried to give %v points with %v of %v already used", e.Requested, e.Used, e.Limit)
+}
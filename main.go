@@ -11,13 +11,30 @@ import (
 func main() {
 	ReadConfig()
 
-	db, err := BotConfig.DbConfig.Connect()
+	store, err := BotConfig.DbConfig.Connect()
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v\n", err)
 	}
+
+	err = store.Migrate()
+	if err != nil {
+		_ = store.Close()
+		log.Fatalf("Failed to migrate database: %v\n", err)
+	}
+
+	// `heykudos migrate` only brings the database up to date without starting the bot
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		log.Printf("Database is up to date\n")
+		_ = store.Close()
+		return
+	}
+
 	defer func() {
 		log.Printf("Shutting down\n")
-		err := db.Close()
+		for _, c := range allCaches() {
+			log.Printf("Cache %v: %v\n", c.name, c.Stats())
+		}
+		err := store.Close()
 		if err != nil {
 			log.Printf("Failed to close database connection properly\n")
 		}
@@ -36,34 +53,103 @@ func main() {
 	emojiApiKey = BotConfig.UserToken
 	api := slack.New(BotConfig.BotToken)
 
-	rtm := api.NewRTM()
-	go rtm.ManageConnection()
+	// Every delivery mode feeds the same events channel, so the event loop doesn't care where events come from
+	var events chan slack.RTMEvent
+	var httpEvents chan slack.RTMEvent
+	switch BotConfig.Mode {
+	case ModeRTM:
+		mapEventTypes()
+		rtm := api.NewRTM()
+		go rtm.ManageConnection()
+		events = rtm.IncomingEvents
+	case ModeEvents, ModeSocket:
+		// There's no connection to announce who the bot is, so that has to be asked for
+		info, err := connectionInfo(api)
+		if err != nil {
+			log.Fatalf("Failed to get bot info: %v\n", err)
+		}
+		Init(info)
+		events = make(chan slack.RTMEvent, eventBufferSize)
+		if BotConfig.Mode == ModeEvents {
+			httpEvents = events
+		} else {
+			go NewSocketMode(api, store, events).Run()
+		}
+	default:
+		log.Fatalf("Unknown mode %q, must be one of %q, %q or %q\n", BotConfig.Mode, ModeRTM, ModeEvents, ModeSocket)
+	}
+
+	if httpEvents != nil && (BotConfig.ListenAddress == "" || BotConfig.SigningSecret == "") {
+		log.Fatalf("The %q mode requires listenAddress and signingSecret to be set\n", ModeEvents)
+	}
+	if BotConfig.ListenAddress != "" {
+		// Anyone can sign requests with an empty secret, so the server can't be trusted without one
+		if BotConfig.SigningSecret == "" {
+			log.Fatalf("listenAddress requires signingSecret to be set\n")
+		}
+		go StartServer(api, store, httpEvents)
+	}
 
 	// Handle a few events
 	// Note messages are handled async
-loop:
 	for {
 		select {
-		case msg := <-rtm.IncomingEvents:
-			switch ev := msg.Data.(type) {
-			case *slack.ConnectedEvent:
-				log.Printf("Connected to Slack API server\n")
-				Init(ev.Info)
-			case *slack.MessageEvent:
-				if ev.Hidden {
-					continue
-				}
-				go MessageHandler(ev, rtm, db)
-			case *slack.LatencyReport:
-				log.Printf("Current latency: %v\n", ev.Value)
-			case *slack.RTMError:
-				log.Printf("Error: %s\n", ev.Error())
-			case *slack.InvalidAuthEvent:
-				log.Println("Invalid credentials")
+		case msg := <-events:
+			if !handleEvent(msg, api, store) {
 				return
 			}
 		case <-cancel:
-			break loop
+			return
 		}
 	}
 }
+
+// handleEvent dispatches a single event to its handler. Returns false if the bot should stop.
+func handleEvent(msg slack.RTMEvent, api Chat, store Store) bool {
+	switch ev := msg.Data.(type) {
+	case *slack.ConnectedEvent:
+		log.Printf("Connected to Slack API server\n")
+		Init(ev.Info)
+	case *slack.MessageEvent:
+		if ev.Hidden {
+			if ev.SubType == "message_deleted" {
+				go MessageDeletedHandler(ev, api, store)
+			}
+			return true
+		}
+		go MessageHandler(&Request{MessageEvent: ev}, api, store)
+	case *slack.ReactionAddedEvent:
+		go ReactionAddedHandler(ev, api, store)
+	case *slack.ReactionRemovedEvent:
+		go ReactionRemovedHandler(ev, api, store)
+	case *EmojiChangedEvent:
+		go EmojiChangedHandler(ev, store)
+	case *slack.LatencyReport:
+		log.Printf("Current latency: %v\n", ev.Value)
+	case *slack.RTMError:
+		log.Printf("Error: %s\n", ev.Error())
+	case *slack.InvalidAuthEvent:
+		log.Println("Invalid credentials")
+		return false
+	}
+	return true
+}
+
+// connectionInfo builds the same bot and team info that the RTM API sends when connecting
+func connectionInfo(api *slack.Client) (*slack.Info, error) {
+	auth, err := api.AuthTest()
+	if err != nil {
+		return nil, err
+	}
+
+	team, err := api.GetTeamInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	return &slack.Info{
+		URL:  auth.URL,
+		User: &slack.UserDetails{ID: auth.UserID, Name: auth.User},
+		Team: &slack.Team{ID: team.ID, Name: team.Name, Domain: team.Domain},
+	}, nil
+}
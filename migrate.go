@@ -0,0 +1,183 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationFiles holds the schema migrations for every database, in sql/migrations/<driver>/<version>_<name>.sql.
+// Every driver has the same versions, so a schema version means the same thing no matter which database is used.
+//
+//go:embed sql/migrations
+var migrationFiles embed.FS
+
+type migration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// loadMigrations reads the migrations for the driver, ordered by version
+func loadMigrations(driver string) ([]*migration, error) {
+	dir := path.Join("sql/migrations", driver)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]*migration, 0, len(entries))
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		index := strings.Index(name, "_")
+		if index == -1 {
+			return nil, fmt.Errorf("migration %v isn't named <version>_<name>.sql", entry.Name())
+		}
+		version, err := strconv.Atoi(name[:index])
+		if err != nil {
+			return nil, fmt.Errorf("migration %v isn't named <version>_<name>.sql", entry.Name())
+		}
+
+		data, err := migrationFiles.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, &migration{version, name[index+1:], splitStatements(string(data))})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// splitStatements splits a migration into its statements. Not every driver can run several statements at once, so
+// they're run one by one. Statements end with a semicolon at the end of a line.
+func splitStatements(script string) []string {
+	statements := make([]string, 0)
+	sb := strings.Builder{}
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(sb.String()))
+			sb.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(sb.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+func (s *sqlStore) Migrate() error {
+	migrations, err := loadMigrations(s.dialect.name)
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.exec(s.db, s.dialect.schemaVersionTable); err != nil {
+		return err
+	}
+
+	var current int
+	err = s.queryRow(s.db, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	if current == 0 {
+		current, err = s.baseline(migrations)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		log.Printf("Applying database migration %v (%v)\n", m.version, m.name)
+		if err = s.apply(m); err != nil {
+			return fmt.Errorf("migration %v (%v) failed: %v", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+// apply runs the migration and records it in schema_version. MySQL commits schema changes immediately, so unlike the
+// other databases a failed MySQL migration can leave some of its statements applied.
+func (s *sqlStore) apply(m *migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range m.statements {
+		if _, err = tx.Exec(statement); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = s.exec(tx, "INSERT INTO schema_version (version, name) VALUES (?, ?)", m.version, m.name)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// baseline works out which migrations were already applied to a database set up before migrations existed, by the old
+// sql/create.sql and upgrade scripts. Those migrations are recorded in schema_version without being run again. Returns
+// the version the database is at, which is 0 for an empty database.
+func (s *sqlStore) baseline(migrations []*migration) (int, error) {
+	// Each of these checks whether a migration's changes exist, newest first
+	checks := []struct {
+		version int
+		query   string
+	}{
+		{3, "SELECT revoked_at FROM kudos_grants WHERE 1 = 0"},
+		{2, "SELECT id FROM kudos_grants WHERE 1 = 0"},
+		{1, "SELECT id FROM users WHERE 1 = 0"},
+	}
+
+	version := 0
+	for _, check := range checks {
+		rows, err := s.db.Query(check.query)
+		if err == nil {
+			CloseRows(rows)
+			version = check.version
+			break
+		}
+	}
+
+	if version == 0 {
+		return 0, nil
+	}
+
+	log.Printf("Existing database is at schema version %v, recording it in schema_version\n", version)
+	for _, m := range migrations {
+		if m.version > version {
+			break
+		}
+		_, err := s.exec(s.db, "INSERT INTO schema_version (version, name) VALUES (?, ?)", m.version, m.name)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return version, nil
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 	"github.com/nlopes/slack"
 	"log"
@@ -10,149 +9,127 @@ import (
 	"strings"
 )
 
-func PersonalStats(ev *slack.MessageEvent, rtm *slack.RTM, db *sql.DB) {
-	emojis := EmojiMatch(ev)
+func PersonalStats(req *Request, api Chat, store Store) {
+	emojis := EmojiMatch(req)
 
-	user, err := GetUser(ev.User, rtm, db)
+	user, err := GetUser(req.User, api, store)
 
 	if err != nil {
 		log.Printf("Error while querying for user: %v\n", err)
 		return
 	}
 
-	rcvStats := calcStats(emojis, user, db, true)
+	window, err := WindowMatch(req, user)
+	if err != nil {
+		invalidWindow(user, api, err)
+		return
+	}
+
+	rcvStats := calcStats(emojis, window, user, store, true)
 	if rcvStats == nil {
 		return
 	}
-	gvnStats := calcStats(emojis, user, db, false)
+	gvnStats := calcStats(emojis, window, user, store, false)
 	if gvnStats == nil {
 		return
 	}
 
-	_, _, err = rtm.PostMessage(
-		ev.Channel,
-		slack.MsgOptionUsername(BotUsername),
-		slack.MsgOptionPostEphemeral(user.SlackId),
-		slack.MsgOptionAttachments(*rcvStats, *gvnStats),
-	)
+	err = req.Reply(api, true, "", *rcvStats, *gvnStats)
 
 	if err != nil {
-		log.Printf("Error while sending message to %v: %v\n", ev.Channel, err)
+		log.Printf("Error while sending message to %v: %v\n", req.Channel, err)
 	}
 }
 
-func calcStats(emojis []string, user *User, db *sql.DB, received bool) *slack.Attachment {
-	var rows *sql.Rows
-	var err error
-
-	var target string
-	var join string
-	if received {
-		join = "k.sender"
-		target = "k.recipient"
-	} else {
-		join = "k.recipient"
-		target = "k.sender"
-	}
-
-	if len(emojis) == 0 {
-		rows, err = db.Query(fmt.Sprintf(`
-			SELECT %s, k.emoji, k.count, u.username
-			FROM kudos k
-				INNER JOIN users u ON %s = u.id
-			WHERE %s = ?
-			ORDER BY k.count DESC, u.username DESC
-			`, join, join, target), user.Id)
-	} else {
-		rows, err = db.Query(fmt.Sprintf(`
-			SELECT %s, k.emoji, k.count, u.username
-			FROM kudos k
-				INNER JOIN users u ON %s = u.id
-			WHERE %s = ?
-				AND k.emoji IN (%s)
-			ORDER BY k.count DESC, u.username DESC
-		`, join, join, target, createParams(emojis)), generify(emojis, user.Id)...)
-
-	}
-
+func calcStats(emojis []string, window *TimeWindow, user *User, store Store, received bool) *slack.Attachment {
+	kudosRows, err := store.Stats(user.Id, expandEmojiAliases(emojis), window, received)
 	if err != nil {
 		log.Printf("Error while querying for My Kudos Board: %v\n", err)
 		return nil
 	}
 
 	userKudos := make(map[int]*UserKudos)
-	for rows.Next() {
-		kudosRow := KudosRow{}
-		err = rows.Scan(&kudosRow.SenderId, &kudosRow.Emoji, &kudosRow.Count, &kudosRow.SenderName)
-
-		if err != nil {
-			log.Printf("Failed to get user count data: %v\n", err)
-			return nil
-		}
-
+	for _, kudosRow := range kudosRows {
 		kudo, ok := userKudos[kudosRow.SenderId]
 		if !ok {
-			userKudo := UserKudos{
+			kudo = &UserKudos{
 				SenderId:   kudosRow.SenderId,
 				Kudos:      make([]*GivenKudos, 0),
 				SenderName: kudosRow.SenderName,
 			}
-			userKudo.Kudos = append(userKudo.Kudos, &GivenKudos{
-				Emoji: kudosRow.Emoji,
-				Count: kudosRow.Count,
-			})
-			userKudo.TotalCount = kudosRow.Count
-			userKudos[kudosRow.SenderId] = &userKudo
-		} else {
-			kudo.Kudos = append(kudo.Kudos, &GivenKudos{
-				Emoji: kudosRow.Emoji,
-				Count: kudosRow.Count,
-			})
-			kudo.TotalCount = kudo.TotalCount + kudosRow.Count
+			userKudos[kudosRow.SenderId] = kudo
 		}
+		kudo.add(normalizeEmoji(kudosRow.Emoji), kudosRow.Count, kudosRow.Points)
 	}
-	defer CloseRows(rows)
 
 	kudosList := make([]*UserKudos, 0, len(userKudos))
 	for _, v := range userKudos {
 		kudosList = append(kudosList, v)
+		// Merging aliases can change how the emojis rank
+		sort.SliceStable(v.Kudos, func(i, j int) bool {
+			return v.Kudos[i].Points > v.Kudos[j].Points
+		})
 	}
 	sort.Slice(kudosList, func(i, j int) bool {
-		if kudosList[i].TotalCount != kudosList[j].TotalCount {
-			return kudosList[i].TotalCount > kudosList[j].TotalCount
+		if kudosList[i].TotalPoints != kudosList[j].TotalPoints {
+			return kudosList[i].TotalPoints > kudosList[j].TotalPoints
 		}
 		return kudosList[i].SenderName < kudosList[j].SenderName
 	})
 
-	return MyBoard(emojis, kudosList, received)
+	return MyBoard(emojis, window, kudosList, received)
 }
 
 type GivenKudos struct {
-	Emoji string
-	Count int
+	Emoji  string
+	Count  int
+	Points int
 }
 
 type UserKudos struct {
-	SenderId   int
-	Kudos      []*GivenKudos
-	SenderName string
-	TotalCount int
+	SenderId    int
+	Kudos       []*GivenKudos
+	SenderName  string
+	TotalPoints int
+}
+
+// add counts kudos of the emoji towards the user's totals. Kudos stored under an alias of an emoji are merged into the
+// emoji they're an alias of.
+func (u *UserKudos) add(emoji string, count int, points int) {
+	u.TotalPoints += points
+	for _, kudos := range u.Kudos {
+		if kudos.Emoji == emoji {
+			kudos.Count += count
+			kudos.Points += points
+			return
+		}
+	}
+	u.Kudos = append(u.Kudos, &GivenKudos{Emoji: emoji, Count: count, Points: points})
 }
 
 type KudosRow struct {
 	SenderId   int
 	Emoji      string
 	Count      int
+	Points     int
 	SenderName string
 }
 
-func EmojiMatch(ev *slack.MessageEvent) []string {
+// EmojiMatch finds the emojis in a command which limit what it counts, by their canonical names
+func EmojiMatch(req *Request) []string {
 	// Find emojis to specify for leaderboard
-	emojis := emojiPattern.FindAllStringSubmatch(ev.Text, -1)
-	return unique(flatten(emojis, 1))
+	emojis := flatten(emojiPattern.FindAllStringSubmatch(req.Text, -1), 1)
+	canonical := make([]string, 0, len(emojis))
+	for _, emoji := range emojis {
+		if emoji == "" {
+			continue
+		}
+		canonical = append(canonical, normalizeEmoji(emoji))
+	}
+	return unique(canonical)
 }
 
-func MyBoard(emojiTexts []string, userKudos []*UserKudos, received bool) *slack.Attachment {
+func MyBoard(emojiTexts []string, window *TimeWindow, userKudos []*UserKudos, received bool) *slack.Attachment {
 	sb := strings.Builder{}
 	if len(emojiTexts) == 0 {
 		sb.WriteString("all")
@@ -164,6 +141,10 @@ func MyBoard(emojiTexts []string, userKudos []*UserKudos, received bool) *slack.
 			sb.WriteString(fmt.Sprintf(":%v:", text))
 		}
 	}
+	if window != nil {
+		sb.WriteString(", ")
+		sb.WriteString(window.Name)
+	}
 
 	var title string
 	if received {
@@ -184,16 +165,20 @@ func formatMyBoardCounts(userKudos []*UserKudos) string {
 
 	total := 0
 	for i, kudos := range userKudos {
-		total += kudos.TotalCount
+		total += kudos.TotalPoints
 		if i != 0 {
 			builder.WriteString("\n")
 		}
 		lineBuilder := strings.Builder{}
 		for _, gifts := range kudos.Kudos {
 			lineBuilder.WriteString(fmt.Sprintf("\n\t:%v:: `%v`", gifts.Emoji, gifts.Count))
+			// Weighted emojis show what their count was worth
+			if gifts.Points != gifts.Count {
+				lineBuilder.WriteString(fmt.Sprintf(" (`%v` points)", gifts.Points))
+			}
 		}
-		builder.WriteString(fmt.Sprintf("%v. `%v`: `%v`%v", i+1, kudos.SenderName, kudos.TotalCount, lineBuilder.String()))
+		builder.WriteString(fmt.Sprintf("%v. `%v`: `%v`%v", i+1, kudos.SenderName, kudos.TotalPoints, lineBuilder.String()))
 	}
 
-	return "Total Count: `" + strconv.Itoa(total) + "`\n" + builder.String()
+	return "Total Points: `" + strconv.Itoa(total) + "`\n" + builder.String()
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"github.com/nlopes/slack"
+	"log"
+)
+
+// ReactionAddedHandler gives kudos to the author of a message when someone reacts to it with an emoji. This goes
+// through the same rate limiting as kudos given in a message.
+func ReactionAddedHandler(ev *slack.ReactionAddedEvent, api Chat, store Store) {
+	if !isKudosReaction(ev.Item.Type, ev.User, ev.ItemUser) {
+		return
+	}
+
+	if !checkChannelEnabled(ev.Item.Channel, store) {
+		return
+	}
+
+	reaction, ok := canonicalEmoji(ev.Reaction)
+	if !ok {
+		return
+	}
+
+	settings := getChannelSettings(ev.Item.Channel, store)
+	if settings == nil || !settings.allowsEmoji(reaction) {
+		return
+	}
+
+	from, err := GetUser(ev.User, api, store)
+	if err != nil {
+		log.Printf("Failed to get info for user %v: %v\n", ev.User, err)
+		return
+	}
+	to, err := GetUser(ev.ItemUser, api, store)
+	if err != nil {
+		log.Printf("Failed to get info for user %v: %v\n", ev.ItemUser, err)
+		return
+	}
+
+	GiveKudos(from, []*Gift{{To: to, Emojis: []string{reaction}}}, store, api, ev.Item.Channel, ev.Item.Timestamp)
+}
+
+// ReactionRemovedHandler withdraws the kudos given by a reaction when that reaction is removed again
+func ReactionRemovedHandler(ev *slack.ReactionRemovedEvent, api Chat, store Store) {
+	if !isKudosReaction(ev.Item.Type, ev.User, ev.ItemUser) {
+		return
+	}
+
+	from, err := GetUser(ev.User, api, store)
+	if err != nil {
+		log.Printf("Failed to get info for user %v: %v\n", ev.User, err)
+		return
+	}
+	to, err := GetUser(ev.ItemUser, api, store)
+	if err != nil {
+		log.Printf("Failed to get info for user %v: %v\n", ev.ItemUser, err)
+		return
+	}
+
+	// Kudos given before emojis were normalized were recorded under the reaction's own name
+	grant, err := store.ReactionGrant(from.Id, to.Id, normalizeEmoji(ev.Reaction), ev.Item.Channel, ev.Item.Timestamp)
+	if err == nil && grant == nil && normalizeEmoji(ev.Reaction) != ev.Reaction {
+		grant, err = store.ReactionGrant(from.Id, to.Id, ev.Reaction, ev.Item.Channel, ev.Item.Timestamp)
+	}
+	if err != nil {
+		log.Printf("Failed to find kudos for removed reaction: %v\n", err)
+		return
+	}
+	if grant == nil {
+		return
+	}
+
+	withdrawGrants([]*Grant{grant}, "the reaction was removed", store.RevokeGrant, api, store)
+}
+
+// isKudosReaction determines if a reaction could give kudos at all. Only reactions on messages count, and reacting to
+// your own message doesn't give yourself kudos.
+func isKudosReaction(itemType string, user string, itemUser string) bool {
+	return itemType == "message" && itemUser != "" && user != itemUser
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"github.com/nlopes/slack"
+	"testing"
+)
+
+// react has the user add the reaction to the author's message, handling it the same way as one received from Slack
+func (b *testBot) react(user string, author string, channel string, ts string, reaction string) {
+	ev := &slack.ReactionAddedEvent{User: user, ItemUser: author, Reaction: reaction}
+	ev.Item.Type = "message"
+	ev.Item.Channel = channel
+	ev.Item.Timestamp = ts
+	ReactionAddedHandler(ev, b.slack, b.store)
+}
+
+// unreact has the user remove the reaction from the author's message again
+func (b *testBot) unreact(user string, author string, channel string, ts string, reaction string) {
+	ev := &slack.ReactionRemovedEvent{User: user, ItemUser: author, Reaction: reaction}
+	ev.Item.Type = "message"
+	ev.Item.Channel = channel
+	ev.Item.Timestamp = ts
+	ReactionRemovedHandler(ev, b.slack, b.store)
+}
+
+func TestRemovedReactionWithdrawsKudos(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UBOB", "CGENERAL", "Fixed the build")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco: :taco:")
+
+	bot.react("UALICE", "UBOB", "CGENERAL", "1600000000.000002", "taco")
+	if got := bot.received("UBOB"); got != 5 {
+		t.Errorf("expected bob to have received 5 kudos, got %v", got)
+	}
+	bot.expectDM("UALICE", "You don't have any kudos left to give today.")
+	bot.slack.reset()
+
+	bot.unreact("UALICE", "UBOB", "CGENERAL", "1600000000.000002", "taco")
+	if got := bot.received("UBOB"); got != 4 {
+		t.Errorf("expected the reaction's kudos to be withdrawn, got %v", got)
+	}
+	bot.expectDM("UALICE", "Your kudos to `bob` (:taco:: `1`) were withdrawn because the reaction was removed.")
+	bot.expectDM("UBOB", "The kudos you received from `alice` (:taco:: `1`) were withdrawn because the reaction was removed.")
+
+	// alice got the kudo back to give again
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco:")
+	bot.expectDM("UALICE", "You don't have any kudos left to give today.")
+	if got := bot.received("UBOB"); got != 5 {
+		t.Errorf("expected bob to have received 5 kudos, got %v", got)
+	}
+
+	// Removing it again doesn't withdraw anything else
+	bot.slack.reset()
+	bot.unreact("UALICE", "UBOB", "CGENERAL", "1600000000.000002", "taco")
+	bot.expectNoDMs("UALICE")
+	if got := bot.received("UBOB"); got != 5 {
+		t.Errorf("expected bob to still have 5 kudos, got %v", got)
+	}
+}
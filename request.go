@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/nlopes/slack"
+	"net/http"
+)
+
+// Request is a message or command being handled by the bot. Messages come from the channel they were sent in, while
+// slash commands also carry the response URL that replies to the command have to be sent to.
+type Request struct {
+	*slack.MessageEvent
+	ResponseURL string
+}
+
+// commandResponse is the payload posted to a slash command's response URL
+type commandResponse struct {
+	ResponseType string             `json:"response_type"`
+	Text         string             `json:"text,omitempty"`
+	Attachments  []slack.Attachment `json:"attachments,omitempty"`
+}
+
+// Reply answers the request. Messages are answered in the channel they were sent in, ephemeral replies are only shown
+// to the user who sent the message. Slash commands are always answered ephemerally through their response URL.
+func (req *Request) Reply(api Chat, ephemeral bool, text string, attachments ...slack.Attachment) error {
+	if req.ResponseURL != "" {
+		return postResponse(req.ResponseURL, &commandResponse{
+			ResponseType: "ephemeral",
+			Text:         text,
+			Attachments:  attachments,
+		})
+	}
+
+	options := []slack.MsgOption{slack.MsgOptionUsername(BotUsername)}
+	if ephemeral {
+		options = append(options, slack.MsgOptionPostEphemeral(req.User))
+	}
+	if text != "" {
+		options = append(options, slack.MsgOptionText(text, false))
+	}
+	if len(attachments) != 0 {
+		options = append(options, slack.MsgOptionAttachments(attachments...))
+	}
+
+	_, _, err := api.PostMessage(req.Channel, options...)
+	return err
+}
+
+func postResponse(url string, response *commandResponse) error {
+	body, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("response URL returned %v", resp.Status)
+	}
+	return nil
+}
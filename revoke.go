@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"github.com/nlopes/slack"
+	"log"
+)
+
+// MessageDeletedHandler withdraws any kudos that were given by a message which has since been deleted. The totals are
+// reversed, the sender's allowance is refunded if it hasn't been reset since, and both sides are told what happened.
+func MessageDeletedHandler(ev *slack.MessageEvent, api Chat, store Store) {
+	grants, err := store.GrantsForMessage(ev.Channel, ev.DeletedTimestamp)
+	if err != nil {
+		log.Printf("Failed to find kudos for deleted message %v in %v: %v\n", ev.DeletedTimestamp, ev.Channel, err)
+		return
+	}
+
+	if len(grants) == 0 {
+		return
+	}
+
+	log.Printf("Revoking %v grants from deleted message %v in %v\n", len(grants), ev.DeletedTimestamp, ev.Channel)
+	withdrawGrants(grants, "the message they were given in was deleted", store.RevokeGrant, api, store)
+}
+
+// withdrawGrants revokes each of the given grants with revoke and lets the senders and recipients know why their kudos
+// were withdrawn. The grants are grouped by sender and recipient so each pair only gets a single message. Kudos taken
+// from a channel's own allowance are counted from the ledger, so there's nothing to refund for them.
+func withdrawGrants(grants []*Grant, reason string, revoke func(*Grant, *Allowance) (bool, error), api Chat, store Store) {
+	type pair struct {
+		sender    int64
+		recipient int64
+	}
+
+	revoked := make(map[pair][]*Sent)
+	pairs := make([]pair, 0)
+
+	for _, grant := range grants {
+		var refund *Allowance
+		if !grant.ChannelAllowance {
+			sender, err := store.UserById(grant.Sender)
+			if err != nil {
+				log.Printf("Failed to get info for user %v: %v\n", grant.Sender, err)
+				continue
+			}
+			refund = BotConfig.Policy().Allowance(sender, grant.CreatedAt)
+		}
+
+		ok, err := revoke(grant, refund)
+		if err != nil {
+			log.Printf("Failed to revoke grant %v: %v\n", grant.Id, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		key := pair{grant.Sender, grant.Recipient}
+		if _, seen := revoked[key]; !seen {
+			pairs = append(pairs, key)
+		}
+		revoked[key] = append(revoked[key], &Sent{grant.Emoji, grant.Count})
+	}
+
+	for _, p := range pairs {
+		from, err := store.UserById(p.sender)
+		if err != nil {
+			log.Printf("Failed to get info for user %v: %v\n", p.sender, err)
+			continue
+		}
+		to, err := store.UserById(p.recipient)
+		if err != nil {
+			log.Printf("Failed to get info for user %v: %v\n", p.recipient, err)
+			continue
+		}
+
+		giveString := createGiveString(revoked[p])
+		SendMessage(from, fmt.Sprintf("Your kudos to `%v` (%v) were withdrawn because %v.", to.Username, giveString, reason), api)
+		SendMessage(to, fmt.Sprintf("The kudos you received from `%v` (%v) were withdrawn because %v.", from.Username, giveString, reason), api)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"github.com/nlopes/slack"
+	"testing"
+	"time"
+)
+
+// deleteMessage deletes the message from the channel, handling it the same way as a deletion received from Slack
+func (b *testBot) deleteMessage(channel string, ts string) {
+	MessageDeletedHandler(&slack.MessageEvent{
+		Msg: slack.Msg{
+			Type:             "message",
+			SubType:          "message_deleted",
+			Channel:          channel,
+			DeletedTimestamp: ts,
+		},
+	}, b.slack, b.store)
+}
+
+func TestDeletedMessageWithdrawsKudos(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> <@UCAROL> :taco: :taco:") // one each
+	bot.say("UCAROL", "CGENERAL", "<@UBOB> :star:")
+	bot.slack.reset()
+
+	bot.deleteMessage("CGENERAL", "1600000000.000002")
+	if got := bot.received("UBOB"); got != 1 {
+		t.Errorf("expected bob to only have carol's kudos left, got %v", got)
+	}
+	if got := bot.received("UCAROL"); got != 0 {
+		t.Errorf("expected carol to have no kudos left, got %v", got)
+	}
+	bot.expectDM("UALICE", "Your kudos to `bob` (:taco:: `1`) were withdrawn because the message they were given in was deleted.")
+	bot.expectDM("UALICE", "Your kudos to `carol` (:taco:: `1`) were withdrawn because the message they were given in was deleted.")
+	bot.expectDM("UBOB", "The kudos you received from `alice` (:taco:: `1`) were withdrawn because the message they were given in was deleted.")
+	bot.expectDM("UCAROL", "The kudos you received from `alice` (:taco:: `1`) were withdrawn because the message they were given in was deleted.")
+
+	// The kudos were given today, so alice got her whole allowance back
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco: :taco: :taco:")
+	bot.expectDM("UALICE", "You don't have any kudos left to give today.")
+
+	// Deleting a message again or one without kudos does nothing
+	bot.slack.reset()
+	bot.deleteMessage("CGENERAL", "1600000000.000002")
+	bot.deleteMessage("CGENERAL", "1600000000.000001")
+	bot.expectNoDMs("UALICE")
+	bot.expectNoDMs("UBOB")
+	if got := bot.received("UBOB"); got != 6 {
+		t.Errorf("expected bob to have received 6 kudos, got %v", got)
+	}
+}
+
+func TestDeletedMessageOnlyRefundsCurrentAllowance(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco:")
+
+	// The kudos look like they were given yesterday, when alice's allowance was a different one
+	bot.ageGrants(time.Now().AddDate(0, 0, -1))
+	bot.slack.reset()
+
+	bot.deleteMessage("CGENERAL", "1600000000.000002")
+	if got := bot.received("UBOB"); got != 0 {
+		t.Errorf("expected bob's kudos to be withdrawn, got %v", got)
+	}
+	bot.expectDM("UALICE", "Your kudos to `bob` (:taco:: `2`) were withdrawn")
+
+	// Yesterday's allowance was reset since, so nothing is refunded to today's
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco: :taco: :taco:")
+	bot.expectDM("UALICE", "you tried to give 4 kudos, but you only have 3 kudos left to give today")
+}
+
+func TestDeletedMessageRefundsTheAllowanceItWasTakenFrom(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UALICE", "GSECRET", "<@UBOT> enable")
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco:")
+
+	// The kudos came out of alice's global allowance, so that's where they go back to after the channel gets its own
+	bot.say("UALICE", "CGENERAL", "<@UBOT> config allowance 2")
+	bot.deleteMessage("CGENERAL", "1600000000.000003")
+	bot.slack.reset()
+	bot.say("UALICE", "GSECRET", "<@UBOB> :star: :star: :star: :star: :star:")
+	bot.expectDM("UALICE", "You don't have any kudos left to give today.")
+
+	// These kudos came out of the channel's allowance, so the global allowance alice has used up stays used up once the
+	// channel goes back to it
+	bot.say("UALICE", "CGENERAL", "<@UBOB> :taco: :taco:")
+	bot.say("UALICE", "CGENERAL", "<@UBOT> config allowance default")
+	bot.deleteMessage("CGENERAL", "1600000000.000006")
+	bot.slack.reset()
+	bot.say("UALICE", "GSECRET", "<@UBOB> :star:")
+	bot.expectDM("UALICE", "You can only give 5 kudos per day")
+	if got := bot.received("UBOB"); got != 5 {
+		t.Errorf("expected bob to only have the stars, got %v", got)
+	}
+}
+
+func TestWithdrawnKudosAreLeftOutOfTotals(t *testing.T) {
+	bot := newTestBot(t)
+	bot.say("UALICE", "CGENERAL", "<@UBOT> enable")
+	bot.say("UALICE", "CGENERAL", "<@UCAROL> :taco:")
+	bot.say("UBOB", "CGENERAL", "<@UCAROL> :star:")
+	bot.deleteMessage("CGENERAL", "1600000000.000002")
+
+	given, err := bot.store.Leaderboard(nil, nil, false)
+	if err != nil || len(given) != 1 || given[0].Username != "bob" {
+		t.Errorf("expected only bob to have given kudos, got %+v (%v)", given, err)
+	}
+	carol, _ := bot.store.UserBySlackId("UCAROL")
+	rows, err := bot.store.Stats(carol.Id, nil, nil, true)
+	if err != nil || len(rows) != 1 || rows[0].SenderName != "bob" {
+		t.Errorf("expected carol to only have kudos from bob, got %+v (%v)", rows, err)
+	}
+}
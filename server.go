@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/nlopes/slack"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+)
+
+// maxRequestSize limits how much of a request body is read before verifying it, Slack's payloads are far smaller
+const maxRequestSize = 1 << 20
+
+// StartServer runs the HTTP server which Slack sends slash commands to. If events isn't nil, Events API requests are
+// accepted as well and passed on to that channel. This blocks until the server fails.
+func StartServer(api Chat, store Store, events chan<- slack.RTMEvent) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slack/commands", SlashCommandHandler(api, store))
+	if events != nil {
+		mux.HandleFunc("/slack/events", EventsHandler(events))
+	}
+
+	log.Printf("Listening for Slack requests on %v\n", BotConfig.ListenAddress)
+	err := http.ListenAndServe(BotConfig.ListenAddress, mux)
+	if err != nil {
+		log.Printf("HTTP server stopped: %v\n", err)
+	}
+}
+
+// verifyRequest checks the request's X-Slack-Signature against the signing secret from the config, to make sure it
+// actually came from Slack. The body is read to do this, so it's returned and also put back on the request for later
+// parsing. Every request is rejected if there's no signing secret, since anyone could sign them with an empty one.
+func verifyRequest(r *http.Request) ([]byte, error) {
+	if BotConfig.SigningSecret == "" {
+		return nil, fmt.Errorf("signingSecret isn't set")
+	}
+
+	verifier, err := slack.NewSecretsVerifier(r.Header, BotConfig.SigningSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRequestSize))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if _, err = verifier.Write(body); err != nil {
+		return nil, err
+	}
+	if err = verifier.Ensure(); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
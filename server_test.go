@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSigningSecret = "8f742231b10e8888abcd99yyyzzz85a5"
+
+// signedRequest builds a request to the path signed with the secret at the given time, the same way Slack signs them
+func signedRequest(path string, contentType string, body string, secret string, at time.Time) *http.Request {
+	timestamp := fmt.Sprint(at.Unix())
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":" + body))
+
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", contentType)
+	r.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	r.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestVerifyRequest(t *testing.T) {
+	BotConfig = &Config{SigningSecret: testSigningSecret}
+	body := "token=x&command=%2Fkudos&text=leaderboard"
+
+	r := signedRequest("/slack/commands", "application/x-www-form-urlencoded", body, testSigningSecret, time.Now())
+	read, err := verifyRequest(r)
+	if err != nil || string(read) != body {
+		t.Fatalf("expected the request to be verified with its body, got %q (%v)", read, err)
+	}
+	// The body is still there to be parsed afterwards
+	if again, err := ioutil.ReadAll(r.Body); err != nil || string(again) != body {
+		t.Errorf("expected the body to be put back on the request, got %q (%v)", again, err)
+	}
+
+	for _, test := range []struct {
+		name string
+		r    *http.Request
+	}{
+		{"wrong secret", signedRequest("/slack/commands", "application/x-www-form-urlencoded", body, "not the secret",
+			time.Now())},
+		{"old timestamp", signedRequest("/slack/commands", "application/x-www-form-urlencoded", body,
+			testSigningSecret, time.Now().Add(-6*time.Minute))},
+		{"no signature", httptest.NewRequest(http.MethodPost, "/slack/commands", strings.NewReader(body))},
+	} {
+		if _, err := verifyRequest(test.r); err == nil {
+			t.Errorf("expected a request with %v to be rejected", test.name)
+		}
+	}
+}
+
+func TestEmptySigningSecretRejectsRequests(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.SigningSecret = ""
+
+	// Anyone can sign a request with an empty secret, so even a correctly signed one is rejected
+	if code := bot.slashCommand("UALICE", "CGENERAL", "enable", "http://localhost/unused", ""); code != http.StatusUnauthorized {
+		t.Errorf("expected a request signed with an empty secret to be rejected, got %v", code)
+	}
+	if settings, err := bot.store.ChannelSettings("CGENERAL"); err != nil || settings.Enabled {
+		t.Errorf("expected #general to stay disabled, got %+v (%v)", settings, err)
+	}
+}
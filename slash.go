@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/nlopes/slack"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// SlashCommandHandler handles `/kudos` slash commands. The command text is handled just like a message would be, for
+// example `/kudos leaderboard :taco:` works the same as `@heykudos leaderboard :taco:`, and `/kudos @user :tada:` gives
+// kudos. Slack expects a response within 3 seconds, so the command is acknowledged straight away and the actual
+// reply is sent to the command's response URL.
+func SlashCommandHandler(api Chat, store Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := verifyRequest(r); err != nil {
+			log.Printf("Rejected slash command request: %v\n", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		cmd, err := slack.SlashCommandParse(r)
+		if err != nil {
+			log.Printf("Failed to parse slash command: %v\n", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		go MessageHandler(slashCommandRequest(&cmd), api, store)
+	}
+}
+
+// slashCommandRequest turns a slash command into a request, as if the text of the command had been sent as a message.
+// Commands are prefixed with the bot's mention, anything else is treated as giving kudos.
+func slashCommandRequest(cmd *slack.SlashCommand) *Request {
+	text := strings.TrimSpace(cmd.Text)
+	fields := strings.Fields(text)
+	if len(fields) == 0 || isCommand(fields[0]) {
+		text = CommandText + " " + text
+	}
+
+	return &Request{
+		MessageEvent: &slack.MessageEvent{
+			Msg: slack.Msg{
+				Type:    "message",
+				Channel: cmd.ChannelID,
+				User:    cmd.UserID,
+				Text:    text,
+			},
+		},
+		ResponseURL: cmd.ResponseURL,
+	}
+}
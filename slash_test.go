@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/nlopes/slack"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// responseCollector is a response URL which passes on every response posted to it
+func responseCollector(t *testing.T) (*httptest.Server, <-chan *commandResponse) {
+	responses := make(chan *commandResponse, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response commandResponse
+		if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
+			t.Errorf("failed to decode response: %v", err)
+		}
+		responses <- &response
+	}))
+	t.Cleanup(server.Close)
+	return server, responses
+}
+
+// slashCommand sends the slash command to the handler as the user, signed with the secret
+func (b *testBot) slashCommand(user string, channel string, text string, responseURL string, secret string) int {
+	form := url.Values{
+		"command":      {"/kudos"},
+		"text":         {text},
+		"user_id":      {user},
+		"channel_id":   {channel},
+		"team_domain":  {"test"},
+		"response_url": {responseURL},
+	}
+	r := signedRequest("/slack/commands", "application/x-www-form-urlencoded", form.Encode(), secret, time.Now())
+	w := httptest.NewRecorder()
+	SlashCommandHandler(b.slack, b.store)(w, r)
+	return w.Code
+}
+
+// expectResponse waits for the next response to a slash command and fails the test unless it has the text
+func expectResponse(t *testing.T, responses <-chan *commandResponse, text string) {
+	t.Helper()
+	select {
+	case response := <-responses:
+		if response.ResponseType != "ephemeral" || response.Text != text {
+			t.Errorf("expected an ephemeral response with %q, got %+v", text, response)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected a response with %q, got none", text)
+	}
+}
+
+func TestSlashCommandRequest(t *testing.T) {
+	newTestBot(t)
+	for _, test := range []struct {
+		text     string
+		expected string
+	}{
+		{"leaderboard :taco:", "<@UBOT> leaderboard :taco:"},
+		{"  stats week ", "<@UBOT> stats week"},
+		{"", "<@UBOT> "},
+		{"<@UBOB> :taco: for the review", "<@UBOB> :taco: for the review"},
+	} {
+		form := url.Values{
+			"command":      {"/kudos"},
+			"text":         {test.text},
+			"user_id":      {"UALICE"},
+			"channel_id":   {"CGENERAL"},
+			"response_url": {"https://hooks.slack.com/commands/1"},
+		}
+		r := httptest.NewRequest(http.MethodPost, "/slack/commands", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		cmd, err := slack.SlashCommandParse(r)
+		if err != nil {
+			t.Fatalf("failed to parse slash command: %v", err)
+		}
+
+		req := slashCommandRequest(&cmd)
+		if req.Text != test.expected || req.User != "UALICE" || req.Channel != "CGENERAL" ||
+			req.ResponseURL != "https://hooks.slack.com/commands/1" || req.Type != "message" {
+			t.Errorf("unexpected request for %q: %+v (%v)", test.text, req.MessageEvent.Msg, req.ResponseURL)
+		}
+	}
+}
+
+func TestSlashCommandHandler(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.SigningSecret = testSigningSecret
+	server, responses := responseCollector(t)
+
+	if code := bot.slashCommand("UALICE", "CGENERAL", "enable", server.URL, "not the secret"); code != http.StatusUnauthorized {
+		t.Errorf("expected a request with the wrong signature to be rejected, got %v", code)
+	}
+
+	if code := bot.slashCommand("UALICE", "CGENERAL", "enable", server.URL, testSigningSecret); code != http.StatusOK {
+		t.Fatalf("expected the command to be accepted, got %v", code)
+	}
+	expectResponse(t, responses, "Enabled channel <#CGENERAL>")
+
+	bot.slashCommand("UALICE", "GSECRET", "enable", server.URL, testSigningSecret)
+	expectResponse(t, responses, "Enabled private channel #secret")
+
+	bot.slashCommand("UALICE", "CGENERAL", "disable", server.URL, testSigningSecret)
+	expectResponse(t, responses, "Disabled channel <#CGENERAL>")
+
+	// Everything was answered through the response URL, nothing was posted or sent as a DM
+	if posted := bot.slack.posted("CGENERAL"); len(posted) != 0 {
+		t.Errorf("expected no messages in #general, got %+v", posted)
+	}
+	bot.expectNoDMs("UALICE")
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/nlopes/slack"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// socketOpenURL is the API method which hands out Socket Mode websocket URLs
+	socketOpenURL = "https://slack.com/api/apps.connections.open"
+	// maxSocketBackoff caps how long to wait between dropped connections
+	maxSocketBackoff = 30 * time.Second
+)
+
+// socketEnvelope wraps everything Slack sends over a Socket Mode connection
+type socketEnvelope struct {
+	Type         string          `json:"type"`
+	EnvelopeId   string          `json:"envelope_id"`
+	Reason       string          `json:"reason"`
+	RetryAttempt int             `json:"retry_attempt"`
+	Payload      json.RawMessage `json:"payload"`
+}
+
+// socketAck acknowledges an envelope, Slack redelivers envelopes which aren't acknowledged in time
+type socketAck struct {
+	EnvelopeId string `json:"envelope_id"`
+}
+
+// SocketMode receives events through Slack's Socket Mode, where the bot connects out to Slack over a websocket instead
+// of Slack sending requests to a public HTTP endpoint.
+type SocketMode struct {
+	api    Chat
+	store  Store
+	events chan<- slack.RTMEvent
+	seen   *seenEvents
+	// openURL is where new websocket URLs are asked for, which is socketOpenURL unless testing
+	openURL string
+	// wait is how Run waits before reconnecting, which is time.Sleep unless testing
+	wait func(time.Duration)
+}
+
+func NewSocketMode(api Chat, store Store, events chan<- slack.RTMEvent) *SocketMode {
+	return &SocketMode{
+		api:     api,
+		store:   store,
+		events:  events,
+		seen:    newSeenEvents(seenEventsSize),
+		openURL: socketOpenURL,
+		wait:    time.Sleep,
+	}
+}
+
+// Run connects to Slack and passes the events it receives on to the events channel. Whenever the connection is lost or
+// Slack asks for it to be refreshed, a new connection is opened. Only refreshes reconnect straight away, anything else
+// waits longer each time until Slack says hello on a connection again. This never returns.
+func (s *SocketMode) Run() {
+	backoff := time.Second
+	for {
+		hello, err := s.connect()
+		if hello {
+			backoff = time.Second
+		}
+		if err == nil {
+			continue
+		}
+
+		log.Printf("Socket Mode connection failed: %v\n", err)
+		s.wait(backoff)
+		backoff *= 2
+		if backoff > maxSocketBackoff {
+			backoff = maxSocketBackoff
+		}
+	}
+}
+
+// connect opens a single connection and serves it until it's closed. The returned bool is true if Slack said hello on
+// the connection. The error is only nil if Slack asked for the connection to be refreshed.
+func (s *SocketMode) connect() (bool, error) {
+	wsURL, err := s.open()
+	if err != nil {
+		return false, err
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	hello := false
+	for {
+		envelope := socketEnvelope{}
+		if err = conn.ReadJSON(&envelope); err != nil {
+			return hello, err
+		}
+
+		if envelope.EnvelopeId != "" {
+			if err = conn.WriteJSON(&socketAck{envelope.EnvelopeId}); err != nil {
+				return hello, err
+			}
+		}
+
+		switch envelope.Type {
+		case "hello":
+			log.Printf("Connected to Slack with Socket Mode\n")
+			hello = true
+		case "disconnect":
+			log.Printf("Slack requested a Socket Mode reconnect: %v\n", envelope.Reason)
+			return hello, nil
+		case "events_api":
+			s.handleEvent(&envelope)
+		case "slash_commands":
+			s.handleSlashCommand(&envelope)
+		}
+	}
+}
+
+// open asks Slack for a new websocket URL using the app-level token
+func (s *SocketMode) open() (string, error) {
+	req, err := http.NewRequest("POST", s.openURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+BotConfig.AppToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	result := struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+		URL   string `json:"url"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if !result.Ok {
+		return "", fmt.Errorf("apps.connections.open failed: %v", result.Error)
+	}
+	if _, err = url.Parse(result.URL); err != nil {
+		return "", err
+	}
+
+	return result.URL, nil
+}
+
+// handleEvent unwraps an Events API payload, which is the same as what Slack would send to the Events API endpoint
+func (s *SocketMode) handleEvent(envelope *socketEnvelope) {
+	payload := eventEnvelope{}
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+		log.Printf("Failed to parse Socket Mode event: %v\n", err)
+		return
+	}
+
+	if s.seen.check(payload.EventId) {
+		log.Printf("Dropping duplicate event %v (retry %v)\n", payload.EventId, envelope.RetryAttempt)
+		return
+	}
+
+	event, err := parseEvent(payload.Event)
+	if err != nil {
+		log.Printf("Failed to parse event %v: %v\n", payload.EventId, err)
+		return
+	}
+	if event != nil {
+		s.events <- *event
+	}
+}
+
+// handleSlashCommand runs a slash command sent over the socket, which replies through its response URL as usual
+func (s *SocketMode) handleSlashCommand(envelope *socketEnvelope) {
+	cmd := slack.SlashCommand{}
+	if err := json.Unmarshal(envelope.Payload, &cmd); err != nil {
+		log.Printf("Failed to parse Socket Mode slash command: %v\n", err)
+		return
+	}
+
+	go MessageHandler(slashCommandRequest(&cmd), s.api, s.store)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/nlopes/slack"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSocketServer stands in for Slack's Socket Mode, handing out websocket URLs and passing on every connection made
+// to them
+func fakeSocketServer(t *testing.T) (*httptest.Server, <-chan *websocket.Conn, *int32) {
+	conns := make(chan *websocket.Conn, 2)
+	var opened int32
+	upgrader := websocket.Upgrader{}
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	mux.HandleFunc("/apps.connections.open", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer xapp-test" {
+			_, _ = w.Write([]byte(`{"ok":false,"error":"invalid_auth"}`))
+			return
+		}
+		atomic.AddInt32(&opened, 1)
+		_, _ = w.Write([]byte(`{"ok":true,"url":"ws` + strings.TrimPrefix(server.URL, "http") + `/link"}`))
+	})
+	mux.HandleFunc("/link", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade the connection: %v", err)
+			return
+		}
+		conns <- conn
+	})
+	t.Cleanup(server.Close)
+	return server, conns, &opened
+}
+
+// socketConnect connects the Socket Mode client in the background, returning the server's side of the connection and
+// where the client's result ends up once it's disconnected. Slack is expected to have said hello by then.
+func socketConnect(t *testing.T, s *SocketMode, conns <-chan *websocket.Conn) (*websocket.Conn, <-chan error) {
+	t.Helper()
+	result := make(chan error, 1)
+	go func() {
+		hello, err := s.connect()
+		if !hello {
+			t.Errorf("expected Slack to say hello before disconnecting")
+		}
+		result <- err
+	}()
+
+	select {
+	case conn := <-conns:
+		t.Cleanup(func() {
+			_ = conn.Close()
+		})
+		return conn, result
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the client to connect")
+		return nil, nil
+	}
+}
+
+// sendEnvelope sends the envelope to the client and, if it has an id, waits for the client to acknowledge it
+func sendEnvelope(t *testing.T, conn *websocket.Conn, envelope string, id string) {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(envelope)); err != nil {
+		t.Fatalf("failed to send envelope: %v", err)
+	}
+	if id == "" {
+		return
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	ack := socketAck{}
+	if err := conn.ReadJSON(&ack); err != nil || ack.EnvelopeId != id {
+		t.Fatalf("expected envelope %v to be acknowledged, got %+v (%v)", id, ack, err)
+	}
+}
+
+func TestSocketMode(t *testing.T) {
+	bot := newTestBot(t)
+	BotConfig.AppToken = "xapp-test"
+	server, conns, opened := fakeSocketServer(t)
+	responseServer, responses := responseCollector(t)
+
+	events := make(chan slack.RTMEvent, 2)
+	s := NewSocketMode(bot.slack, bot.store, events)
+	s.openURL = server.URL + "/apps.connections.open"
+	conn, result := socketConnect(t, s, conns)
+	sendEnvelope(t, conn, `{"type":"hello","num_connections":1}`, "")
+
+	// Events are passed on once, even when Slack delivers them again
+	message := `{"type":"event_callback","event_id":"Ev1","event":{"type":"message","channel":"CGENERAL",` +
+		`"user":"UALICE","text":"hi","ts":"1600000000.000001"}}`
+	sendEnvelope(t, conn, `{"type":"events_api","envelope_id":"env-1","payload":`+message+`}`, "env-1")
+	sendEnvelope(t, conn, `{"type":"events_api","envelope_id":"env-2","retry_attempt":1,"payload":`+message+`}`,
+		"env-2")
+
+	// Slash commands are run and answered through their response URL
+	command := `{"command":"/kudos","text":"enable","user_id":"UALICE","channel_id":"CGENERAL","response_url":"` +
+		responseServer.URL + `"}`
+	sendEnvelope(t, conn, `{"type":"slash_commands","envelope_id":"env-3","payload":`+command+`}`, "env-3")
+	expectResponse(t, responses, "Enabled channel <#CGENERAL>")
+
+	if len(events) != 1 {
+		t.Fatalf("expected the event to be passed on once, got %v", len(events))
+	}
+	event := <-events
+	if msg, ok := event.Data.(*slack.MessageEvent); !ok || msg.Text != "hi" || msg.Channel != "CGENERAL" {
+		t.Errorf("expected the message event, got %+v", event)
+	}
+
+	// Being asked to disconnect ends the connection without an error, which has Run connect again straight away
+	sendEnvelope(t, conn, `{"type":"disconnect","reason":"refresh_requested"}`, "")
+	select {
+	case err := <-result:
+		if err != nil {
+			t.Errorf("expected the connection to end cleanly, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the client to disconnect")
+	}
+
+	// The next connection asks for a new websocket URL
+	conn, result = socketConnect(t, s, conns)
+	sendEnvelope(t, conn, `{"type":"hello","num_connections":1}`, "")
+	sendEnvelope(t, conn, `{"type":"disconnect","reason":"refresh_requested"}`, "")
+	if err := <-result; err != nil {
+		t.Errorf("expected the second connection to end cleanly, got %v", err)
+	}
+	if got := atomic.LoadInt32(opened); got != 2 {
+		t.Errorf("expected a websocket URL to be asked for twice, got %v", got)
+	}
+}
+
+func TestSocketModeRejectedToken(t *testing.T) {
+	BotConfig = &Config{AppToken: "xapp-wrong"}
+	server, _, _ := fakeSocketServer(t)
+
+	s := NewSocketMode(nil, nil, nil)
+	s.openURL = server.URL + "/apps.connections.open"
+	connected, err := s.connect()
+	if connected || err == nil || !strings.Contains(err.Error(), "invalid_auth") {
+		t.Errorf("expected the connection to fail with invalid_auth, got %v (%v)", connected, err)
+	}
+}
+
+func TestSocketModeBacksOff(t *testing.T) {
+	BotConfig = &Config{AppToken: "xapp-test"}
+	server, conns, _ := fakeSocketServer(t)
+
+	// Run is left waiting forever once the test is done, which ends its goroutine
+	waits := make(chan time.Duration)
+	done := make(chan bool)
+	t.Cleanup(func() {
+		close(done)
+	})
+	s := NewSocketMode(nil, nil, nil)
+	s.openURL = server.URL + "/apps.connections.open"
+	s.wait = func(d time.Duration) {
+		select {
+		case waits <- d:
+		case <-done:
+			runtime.Goexit()
+		}
+	}
+	go s.Run()
+
+	accept := func() *websocket.Conn {
+		t.Helper()
+		select {
+		case conn := <-conns:
+			t.Cleanup(func() {
+				_ = conn.Close()
+			})
+			return conn
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected the client to connect")
+			return nil
+		}
+	}
+	expectWait := func(expected time.Duration) {
+		t.Helper()
+		select {
+		case d := <-waits:
+			if d != expected {
+				t.Errorf("expected to wait %v before reconnecting, got %v", expected, d)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected to wait %v before reconnecting", expected)
+		}
+	}
+
+	// Connections which are dropped wait longer each time
+	_ = accept().Close()
+	expectWait(time.Second)
+	_ = accept().Close()
+	expectWait(2 * time.Second)
+
+	// Once Slack says hello the wait starts over
+	conn := accept()
+	sendEnvelope(t, conn, `{"type":"hello","num_connections":1}`, "")
+	_ = conn.Close()
+	expectWait(time.Second)
+
+	// Being asked to disconnect doesn't wait at all
+	sendEnvelope(t, accept(), `{"type":"disconnect","reason":"refresh_requested"}`, "")
+	accept()
+	select {
+	case d := <-waits:
+		t.Errorf("expected to reconnect straight away after being asked to, waited %v", d)
+	default:
+	}
+}
@@ -0,0 +1,2 @@
+ALTER TABLE kudos_grants
+  ADD COLUMN revoked_at DATETIME NULL AFTER created_at;
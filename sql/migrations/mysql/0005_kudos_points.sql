@@ -0,0 +1,13 @@
+-- Points are the count weighted by the emoji's configured weight at the time the kudos were given. Everything given
+-- before weights existed was worth one point per emoji.
+ALTER TABLE kudos_grants
+  ADD COLUMN points BIGINT DEFAULT 0 NOT NULL;
+
+UPDATE kudos_grants
+SET points = count;
+
+ALTER TABLE kudos
+  ADD COLUMN points BIGINT DEFAULT 0 NOT NULL;
+
+UPDATE kudos
+SET points = count;
@@ -0,0 +1,4 @@
+-- The time zone from the user's Slack profile, such as America/New_York. Their daily allowance resets at midnight in
+-- this time zone, or the server's if it isn't known yet.
+ALTER TABLE users
+  ADD COLUMN tz VARCHAR(64);
@@ -0,0 +1,4 @@
+-- The points carried over into the period the rate row is for, from the periods before it. The time of a rate row is
+-- now the first day of its period rather than always being a day.
+ALTER TABLE rate
+  ADD COLUMN carried INT DEFAULT 0 NOT NULL;
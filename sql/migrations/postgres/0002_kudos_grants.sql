@@ -0,0 +1,31 @@
+CREATE TABLE kudos_grants
+(
+  id         BIGSERIAL
+    PRIMARY KEY,
+  sender     BIGINT                                NOT NULL,
+  recipient  BIGINT                                NOT NULL,
+  emoji      VARCHAR(255)                          NOT NULL,
+  count      BIGINT                                NOT NULL,
+  channel    VARCHAR(255)                          NULL,
+  message_ts VARCHAR(32)                           NULL,
+  created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT kudos_grants_users_id_fk
+    FOREIGN KEY (sender) REFERENCES users (id)
+      ON UPDATE CASCADE ON DELETE CASCADE,
+  CONSTRAINT kudos_grants_users_id_fk_2
+    FOREIGN KEY (recipient) REFERENCES users (id)
+      ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+CREATE INDEX kudos_grants_channel_message_ts_index
+  ON kudos_grants (channel, message_ts);
+
+CREATE INDEX kudos_grants_created_at_index
+  ON kudos_grants (created_at);
+
+-- The individual grants behind the existing totals were never recorded, so each total becomes a single grant. When
+-- they were given isn't known either, so they're dated 1970-01-01 to keep them out of windows with a start date.
+INSERT INTO kudos_grants (sender, recipient, emoji, count, created_at)
+SELECT k.sender, k.recipient, k.emoji, k.count, '1970-01-01 00:00:00+00'
+FROM kudos k
+WHERE k.count > 0;
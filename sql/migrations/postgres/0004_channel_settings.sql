@@ -0,0 +1,5 @@
+-- An empty allowance means the global amountPerDay applies, an empty emoji list means any emoji can be given
+ALTER TABLE enabled_channels
+  ADD COLUMN allowance INT           NULL,
+  ADD COLUMN emojis    VARCHAR(1024) NULL,
+  ADD COLUMN announce  BOOLEAN DEFAULT FALSE NOT NULL;
@@ -0,0 +1,37 @@
+-- Grants made by an admin don't use up the sender's allowance or count towards their recipient caps
+ALTER TABLE kudos_grants
+  ADD COLUMN by_admin BOOLEAN DEFAULT FALSE NOT NULL;
+
+-- Every change an admin makes to the kudos, with the pair's totals for the emoji before and after it
+CREATE TABLE admin_log
+(
+  id            BIGSERIAL
+    PRIMARY KEY,
+  admin         BIGINT                                NOT NULL,
+  action        VARCHAR(16)                           NOT NULL,
+  sender        BIGINT                                NOT NULL,
+  recipient     BIGINT                                NOT NULL,
+  emoji         VARCHAR(255)                          NOT NULL,
+  grant_id      BIGINT                                NULL,
+  reason        VARCHAR(1024)                         NULL,
+  count_before  BIGINT                                NOT NULL,
+  count_after   BIGINT                                NOT NULL,
+  points_before BIGINT                                NOT NULL,
+  points_after  BIGINT                                NOT NULL,
+  created_at    TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL,
+  CONSTRAINT admin_log_users_id_fk
+    FOREIGN KEY (admin) REFERENCES users (id)
+      ON UPDATE CASCADE ON DELETE CASCADE,
+  CONSTRAINT admin_log_users_id_fk_2
+    FOREIGN KEY (sender) REFERENCES users (id)
+      ON UPDATE CASCADE ON DELETE CASCADE,
+  CONSTRAINT admin_log_users_id_fk_3
+    FOREIGN KEY (recipient) REFERENCES users (id)
+      ON UPDATE CASCADE ON DELETE CASCADE,
+  CONSTRAINT admin_log_kudos_grants_id_fk
+    FOREIGN KEY (grant_id) REFERENCES kudos_grants (id)
+      ON UPDATE CASCADE ON DELETE SET NULL
+);
+
+CREATE INDEX admin_log_created_at_index
+  ON admin_log (created_at);
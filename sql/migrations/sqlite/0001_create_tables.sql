@@ -0,0 +1,39 @@
+CREATE TABLE enabled_channels
+(
+  id      INTEGER PRIMARY KEY AUTOINCREMENT,
+  name    VARCHAR(255)   NOT NULL
+    CONSTRAINT enabled_channels_name_uindex UNIQUE,
+  enabled BOOL DEFAULT 1 NOT NULL
+);
+
+CREATE TABLE users
+(
+  id       INTEGER PRIMARY KEY AUTOINCREMENT,
+  slack_id VARCHAR(255) NOT NULL
+    CONSTRAINT users_slack_id_uindex UNIQUE,
+  username VARCHAR(255) NOT NULL
+    CONSTRAINT users_username_uindex UNIQUE
+);
+
+CREATE TABLE kudos
+(
+  id        INTEGER PRIMARY KEY AUTOINCREMENT,
+  sender    BIGINT           NOT NULL
+    REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  recipient BIGINT           NOT NULL
+    REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  emoji     VARCHAR(255)     NOT NULL,
+  count     BIGINT DEFAULT 0 NOT NULL,
+  CONSTRAINT kudos_sender_recipient_emoji_uindex
+    UNIQUE (sender, recipient, emoji)
+);
+
+CREATE TABLE rate
+(
+  id      INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id BIGINT NOT NULL
+    CONSTRAINT rate_user_id_uindex UNIQUE
+    REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  time    DATE   NOT NULL,
+  count   INT    NOT NULL
+);
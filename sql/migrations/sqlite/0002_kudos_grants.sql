@@ -0,0 +1,27 @@
+-- Times are stored as text, so they're always written in UTC to compare correctly with each other
+CREATE TABLE kudos_grants
+(
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  sender     BIGINT       NOT NULL
+    REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  recipient  BIGINT       NOT NULL
+    REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  emoji      VARCHAR(255) NOT NULL,
+  count      BIGINT       NOT NULL,
+  channel    VARCHAR(255) NULL,
+  message_ts VARCHAR(32)  NULL,
+  created_at DATETIME     NOT NULL
+);
+
+CREATE INDEX kudos_grants_channel_message_ts_index
+  ON kudos_grants (channel, message_ts);
+
+CREATE INDEX kudos_grants_created_at_index
+  ON kudos_grants (created_at);
+
+-- The individual grants behind the existing totals were never recorded, so each total becomes a single grant. When
+-- they were given isn't known either, so they're dated 1970-01-01 to keep them out of windows with a start date.
+INSERT INTO kudos_grants (sender, recipient, emoji, count, created_at)
+SELECT k.sender, k.recipient, k.emoji, k.count, '1970-01-01 00:00:00+00:00'
+FROM kudos k
+WHERE k.count > 0;
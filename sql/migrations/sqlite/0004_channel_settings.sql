@@ -0,0 +1,7 @@
+-- An empty allowance means the global amountPerDay applies, an empty emoji list means any emoji can be given
+ALTER TABLE enabled_channels
+  ADD COLUMN allowance INT NULL;
+ALTER TABLE enabled_channels
+  ADD COLUMN emojis VARCHAR(1024) NULL;
+ALTER TABLE enabled_channels
+  ADD COLUMN announce BOOL DEFAULT 0 NOT NULL;
@@ -0,0 +1,28 @@
+-- Grants made by an admin don't use up the sender's allowance or count towards their recipient caps
+ALTER TABLE kudos_grants
+  ADD COLUMN by_admin BOOL DEFAULT 0 NOT NULL;
+
+-- Every change an admin makes to the kudos, with the pair's totals for the emoji before and after it
+CREATE TABLE admin_log
+(
+  id            INTEGER PRIMARY KEY AUTOINCREMENT,
+  admin         BIGINT        NOT NULL
+    REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  action        VARCHAR(16)   NOT NULL,
+  sender        BIGINT        NOT NULL
+    REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  recipient     BIGINT        NOT NULL
+    REFERENCES users (id) ON UPDATE CASCADE ON DELETE CASCADE,
+  emoji         VARCHAR(255)  NOT NULL,
+  grant_id      BIGINT        NULL
+    REFERENCES kudos_grants (id) ON UPDATE CASCADE ON DELETE SET NULL,
+  reason        VARCHAR(1024) NULL,
+  count_before  BIGINT        NOT NULL,
+  count_after   BIGINT        NOT NULL,
+  points_before BIGINT        NOT NULL,
+  points_after  BIGINT        NOT NULL,
+  created_at    DATETIME      NOT NULL
+);
+
+CREATE INDEX admin_log_created_at_index
+  ON admin_log (created_at);
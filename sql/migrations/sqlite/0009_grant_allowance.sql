@@ -0,0 +1,10 @@
+-- Whether the grant was taken from its channel's own allowance rather than the sender's global allowance. Refunds go
+-- back to the allowance the grant was taken from, even if the channel's allowance has changed since. Grants given so
+-- far are put down to the allowances their channels have now.
+ALTER TABLE kudos_grants
+  ADD COLUMN channel_allowance BOOL DEFAULT 0 NOT NULL;
+
+UPDATE kudos_grants
+SET channel_allowance = TRUE
+WHERE NOT by_admin
+  AND channel IN (SELECT name FROM enabled_channels WHERE allowance IS NOT NULL);
@@ -0,0 +1,77 @@
+package main
+
+// Store is everything the bot keeps in its database. The handlers only talk to the database through this interface, so
+// they don't depend on any particular database or its SQL dialect.
+type Store interface {
+	// UserBySlackId finds a user by their Slack id. Returns nil if the user isn't known yet.
+	UserBySlackId(slackId string) (*User, error)
+	// UserById finds a user which is already known by their database id
+	UserById(id int64) (*User, error)
+	// CreateUser adds a new user, returning it with its new database id. The time zone may be empty if it's not known.
+	CreateUser(slackId string, username string, tz string) (*User, error)
+	// SetUserTz changes the time zone of the user, which is where their daily allowance resets
+	SetUserTz(id int64, tz string) error
+
+	// ChannelSettings returns the channel's settings, including whether kudos can be given in it. Unknown channels get
+	// the default settings and aren't enabled.
+	ChannelSettings(name string) (*ChannelSettings, error)
+	// SetChannelEnabled turns kudos on or off in the channel
+	SetChannelEnabled(name string, enabled bool) error
+	// SaveChannelSettings stores the channel's allowance, emoji list and announcement setting. Whether the channel is
+	// enabled is only stored if the channel wasn't known yet, SetChannelEnabled changes it otherwise.
+	SaveChannelSettings(settings *ChannelSettings) error
+
+	// RecordGrant appends the grant to the ledger and adds it to the per-pair kudos totals. The grant's id and creation
+	// time are filled in.
+	RecordGrant(grant *Grant) error
+	// GrantsForMessage finds all grants which haven't been revoked that were given by the message in the channel
+	GrantsForMessage(channel string, messageTs string) ([]*Grant, error)
+	// ReactionGrant finds the most recent grant which hasn't been revoked that was given by the sender reacting with
+	// the emoji to the recipient's message. Returns nil if there is no such grant.
+	ReactionGrant(sender int64, recipient int64, emoji string, channel string, messageTs string) (*Grant, error)
+	// RevokeGrant marks the grant as revoked and removes it from the kudos totals. If refund is set to the sender's
+	// allowance at the time the grant was given, its points are also refunded to the sender as long as the allowance
+	// hasn't been reset since. Returns false if the grant had already been revoked, in which case nothing is changed.
+	RevokeGrant(grant *Grant, refund *Allowance) (bool, error)
+
+	// AdjustKudos records a grant made by an admin, which can have a negative count to take kudos away, and logs the
+	// action. The action's sender, recipient, emoji, totals and grant are filled in from the grant. Removing more than
+	// the sender has given the recipient with the emoji only removes what there is. Returns false if there was nothing
+	// to change, in which case nothing is logged.
+	AdjustKudos(action *AdminAction, grant *Grant) (bool, error)
+	// VoidGrant revokes the grant like RevokeGrant does, and logs the action in the same transaction. Returns false if
+	// the grant had already been revoked, in which case nothing is logged.
+	VoidGrant(action *AdminAction, grant *Grant, refund *Allowance) (bool, error)
+	// AdminLog returns the most recent admin actions, newest first, with the usernames filled in
+	AdminLog(limit int) ([]*AdminAction, error)
+
+	// GiveGrants records all the grants of one message if the sender's allowance covers them, using up the allowance.
+	// Checking the allowance, using it up and recording the grants happen in a single transaction, so concurrent
+	// messages from the same sender can't overspend it and a failure leaves nothing behind. Returns how many points
+	// the sender has left afterwards, or an *AllowanceError if the grants weren't covered. The allowance's recipient
+	// caps are checked the same way, returning a *RecipientCapError for the first one which would be exceeded. The
+	// grants are marked with whether they were taken from the channel's own allowance, which is what revoking them
+	// refunds.
+	GiveGrants(allowance *Allowance, grants []*Grant) (int, error)
+
+	// Leaderboard returns the top 10 users by the points of the kudos received, or given if received is false. Only
+	// the given emojis are counted, or all of them if there are none, and only within the window if it isn't nil.
+	Leaderboard(emojis []string, window *TimeWindow, received bool) ([]*UserCount, error)
+	// Stats returns the count and points of the kudos the user has received from, or given to if received is false,
+	// each other user per emoji.
+	// The emojis and window limit which kudos are counted the same way as for Leaderboard.
+	Stats(userId int64, emojis []string, window *TimeWindow, received bool) ([]*KudosRow, error)
+
+	// PairTotals returns the points of all the kudos each user has given each other user, for every pair of users where
+	// any have been given
+	PairTotals() ([]*PairTotal, error)
+
+	// RenameEmoji moves every kudos given with the emoji to its new name, merging them into any kudos already given with
+	// the new name
+	RenameEmoji(oldName string, newName string) error
+
+	// Migrate brings the database schema up to date by applying any migrations which haven't been applied yet
+	Migrate() error
+
+	Close() error
+}
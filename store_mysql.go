@@ -0,0 +1,67 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"log"
+	"time"
+)
+
+var mysqlDialect = &dialect{
+	name: DriverMysql,
+	schemaVersionTable: `
+		CREATE TABLE IF NOT EXISTS schema_version
+		(
+		  version    INT                                NOT NULL
+		    PRIMARY KEY,
+		  name       VARCHAR(255)                       NOT NULL,
+		  applied_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL
+		)
+	`,
+	enableChannel: `
+		INSERT INTO enabled_channels (name, enabled)
+		VALUES (?, TRUE)
+		ON DUPLICATE KEY UPDATE
+			enabled = TRUE
+	`,
+	saveChannel: `
+		INSERT INTO enabled_channels (name, enabled, allowance, emojis, announce)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			allowance = VALUES(allowance),
+			emojis = VALUES(emojis),
+			announce = VALUES(announce)
+	`,
+	addKudos: `
+		INSERT INTO kudos (sender, recipient, emoji, count, points)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			count = count + VALUES(count),
+			points = points + VALUES(points)
+	`,
+}
+
+func newMysqlStore(conf DbConfig) (Store, error) {
+	config := mysql.Config{
+		User:                 conf.Username,
+		Passwd:               conf.Password,
+		Net:                  "tcp",
+		Addr:                 fmt.Sprintf("%v:%v", conf.Hostname, conf.Port),
+		DBName:               conf.Database,
+		AllowNativePasswords: true,
+		ParseTime:            true,
+		Loc:                  time.Local,
+	}
+	dsn := config.FormatDSN()
+	log.Printf("Using %v to connect to database\n", dsn)
+	db, err := sql.Open(
+		"mysql",
+		dsn,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlStore{db, mysqlDialect}, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	_ "github.com/lib/pq"
+	"log"
+	"net/url"
+)
+
+var postgresDialect = &dialect{
+	name: DriverPostgres,
+	schemaVersionTable: `
+		CREATE TABLE IF NOT EXISTS schema_version
+		(
+		  version    INT                                   NOT NULL
+		    PRIMARY KEY,
+		  name       VARCHAR(255)                          NOT NULL,
+		  applied_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP NOT NULL
+		)
+	`,
+	enableChannel: `
+		INSERT INTO enabled_channels (name, enabled)
+		VALUES (?, TRUE)
+		ON CONFLICT (name) DO UPDATE SET
+			enabled = TRUE
+	`,
+	saveChannel: `
+		INSERT INTO enabled_channels (name, enabled, allowance, emojis, announce)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			allowance = excluded.allowance,
+			emojis = excluded.emojis,
+			announce = excluded.announce
+	`,
+	addKudos: `
+		INSERT INTO kudos (sender, recipient, emoji, count, points)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (sender, recipient, emoji) DO UPDATE SET
+			count = kudos.count + excluded.count,
+			points = kudos.points + excluded.points
+	`,
+	numbered:  true,
+	returning: true,
+}
+
+func newPostgresStore(conf DbConfig) (Store, error) {
+	params := url.Values{}
+	if conf.SslMode != "" {
+		params.Set("sslmode", conf.SslMode)
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(conf.Username, conf.Password),
+		Host:     fmt.Sprintf("%v:%v", conf.Hostname, conf.Port),
+		Path:     conf.Database,
+		RawQuery: params.Encode(),
+	}
+	log.Printf("Using %v to connect to database\n", dsn.Redacted())
+	db, err := sql.Open("postgres", dsn.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlStore{db, postgresDialect}, nil
+}
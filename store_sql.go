@@ -0,0 +1,868 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dialect holds the statements which can't be written the same way for every database. Everything else in sqlStore is
+// plain SQL.
+type dialect struct {
+	// name is the driver name, which is also the directory holding its migrations
+	name string
+	// schemaVersionTable creates the schema_version table if it doesn't exist yet
+	schemaVersionTable string
+	// enableChannel inserts or re-enables the channel given as the only parameter
+	enableChannel string
+	// saveChannel inserts the name, enabled, allowance, emojis, announce row for a channel, or updates the existing
+	// channel's allowance, emojis and announce
+	saveChannel string
+	// addKudos inserts the sender, recipient, emoji, count, points total or adds the count and points to the existing
+	// total
+	addKudos string
+	// numbered is set for databases which use numbered placeholders ($1, $2, ...) rather than ?
+	numbered bool
+	// returning is set for databases which can't report the last inserted id, the id is returned by the INSERT instead
+	returning bool
+	// utcTimes is set for databases which store times as text along with their UTC offset. Times are converted to UTC
+	// before they're written or compared, otherwise times in different time zones would compare as the wrong strings.
+	utcTimes bool
+}
+
+// sqlStore is a Store backed by a SQL database. Queries are written with ? placeholders, and go through the exec, query
+// and queryRow helpers to be rewritten for the dialect.
+type sqlStore struct {
+	db      *sql.DB
+	dialect *dialect
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// rebind rewrites the ? placeholders in the query into the dialect's placeholders
+func (s *sqlStore) rebind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+
+	sb := strings.Builder{}
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			sb.WriteString(fmt.Sprintf("$%v", n))
+		} else {
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String()
+}
+
+// bind converts the query's parameters into what the dialect expects
+func (s *sqlStore) bind(args []interface{}) []interface{} {
+	if !s.dialect.utcTimes {
+		return args
+	}
+
+	bound := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case time.Time:
+			bound[i] = v.UTC()
+		case *time.Time:
+			if v != nil {
+				bound[i] = v.UTC()
+			}
+		default:
+			bound[i] = arg
+		}
+	}
+	return bound
+}
+
+func (s *sqlStore) exec(q queryer, query string, args ...interface{}) (sql.Result, error) {
+	return q.Exec(s.rebind(query), s.bind(args)...)
+}
+
+func (s *sqlStore) query(q queryer, query string, args ...interface{}) (*sql.Rows, error) {
+	return q.Query(s.rebind(query), s.bind(args)...)
+}
+
+func (s *sqlStore) queryRow(q queryer, query string, args ...interface{}) *sql.Row {
+	return q.QueryRow(s.rebind(query), s.bind(args)...)
+}
+
+// insert runs the INSERT statement and returns the id of the new row
+func (s *sqlStore) insert(q queryer, query string, args ...interface{}) (int64, error) {
+	if s.dialect.returning {
+		var id int64
+		err := s.queryRow(q, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	res, err := s.exec(q, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+func (s *sqlStore) UserBySlackId(slackId string) (*User, error) {
+	user := User{}
+	var tz sql.NullString
+	err := s.queryRow(s.db, "SELECT id, slack_id, username, tz FROM users WHERE slack_id = ?", slackId).
+		Scan(&user.Id, &user.SlackId, &user.Username, &tz)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	user.Tz = tz.String
+	return &user, nil
+}
+
+func (s *sqlStore) UserById(id int64) (*User, error) {
+	user := User{}
+	var tz sql.NullString
+	err := s.queryRow(s.db, "SELECT id, slack_id, username, tz FROM users WHERE id = ?", id).
+		Scan(&user.Id, &user.SlackId, &user.Username, &tz)
+	if err != nil {
+		return nil, err
+	}
+	user.Tz = tz.String
+	return &user, nil
+}
+
+func (s *sqlStore) CreateUser(slackId string, username string, tz string) (*User, error) {
+	id, err := s.insert(s.db, "INSERT INTO users (slack_id, username, tz) VALUES (?, ?, ?)", slackId, username,
+		nullString(tz))
+	if err != nil {
+		return nil, err
+	}
+
+	return &User{id, slackId, username, tz}, nil
+}
+
+func (s *sqlStore) SetUserTz(id int64, tz string) error {
+	_, err := s.exec(s.db, "UPDATE users SET tz = ? WHERE id = ?", nullString(tz), id)
+	return err
+}
+
+func (s *sqlStore) ChannelSettings(name string) (*ChannelSettings, error) {
+	settings := ChannelSettings{Name: name}
+	var allowance sql.NullInt64
+	var emojis sql.NullString
+	err := s.queryRow(s.db, "SELECT enabled, allowance, emojis, announce FROM enabled_channels WHERE name = ?", name).
+		Scan(&settings.Enabled, &allowance, &emojis, &settings.Announce)
+	if err == sql.ErrNoRows {
+		return &settings, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	settings.Allowance = int(allowance.Int64)
+	settings.Emojis = strings.Fields(emojis.String)
+	return &settings, nil
+}
+
+func (s *sqlStore) SetChannelEnabled(name string, enabled bool) error {
+	var err error
+	if enabled {
+		_, err = s.exec(s.db, s.dialect.enableChannel, name)
+	} else {
+		_, err = s.exec(s.db, "UPDATE enabled_channels SET enabled = FALSE WHERE name = ?", name)
+	}
+	return err
+}
+
+func (s *sqlStore) SaveChannelSettings(settings *ChannelSettings) error {
+	allowance := sql.NullInt64{Int64: int64(settings.Allowance), Valid: settings.Allowance > 0}
+	emojis := nullString(strings.Join(settings.Emojis, " "))
+	_, err := s.exec(s.db, s.dialect.saveChannel, settings.Name, settings.Enabled, allowance, emojis, settings.Announce)
+	return err
+}
+
+func (s *sqlStore) RecordGrant(grant *Grant) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err = s.recordGrant(tx, grant); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// recordGrant appends the grant to the ledger and adds it to the kudos totals as part of the transaction
+func (s *sqlStore) recordGrant(tx *sql.Tx, grant *Grant) error {
+	if grant.CreatedAt.IsZero() {
+		grant.CreatedAt = time.Now()
+	}
+
+	var err error
+	grant.Id, err = s.insert(tx, `
+		INSERT INTO kudos_grants (sender, recipient, emoji, count, points, channel, message_ts, created_at, by_admin,
+			channel_allowance)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, grant.Sender, grant.Recipient, grant.Emoji, grant.Count, grant.Points, nullString(grant.Channel),
+		nullString(grant.MessageTs), grant.CreatedAt, grant.ByAdmin, grant.ChannelAllowance)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(tx, s.dialect.addKudos, grant.Sender, grant.Recipient, grant.Emoji, grant.Count, grant.Points)
+	return err
+}
+
+func (s *sqlStore) GiveGrants(allowance *Allowance, grants []*Grant) (int, error) {
+	requested := 0
+	for _, grant := range grants {
+		requested += int(grant.Points)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	// Locking the sender makes their other kudos wait for this transaction to finish, so they can't both spend the
+	// same allowance
+	_, err = s.exec(tx, "UPDATE users SET username = username WHERE id = ?", allowance.Sender)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	var used int
+	limit := allowance.Limit
+	switch {
+	case allowance.Channel != "":
+		used, err = s.sentSince(tx, allowance.Sender, allowance.Channel, allowance.Since)
+	case allowance.Rolling:
+		used, err = s.sentSince(tx, allowance.Sender, "", allowance.Since)
+	default:
+		used, limit, err = s.spendPeriod(tx, allowance, requested)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	if used+requested > limit {
+		_ = tx.Rollback()
+		return 0, &AllowanceError{Limit: limit, Used: used, Requested: requested}
+	}
+
+	if err = s.checkRecipientCaps(tx, allowance, grants); err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	for _, grant := range grants {
+		grant.ChannelAllowance = allowance.Channel != ""
+		if err = s.recordGrant(tx, grant); err != nil {
+			_ = tx.Rollback()
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return limit - used - requested, nil
+}
+
+// checkRecipientCaps makes sure the grants don't give any recipient more than the allowance's recipient caps allow.
+// Returns a *RecipientCapError for the first cap which would be exceeded. Grants made by admins aren't counted.
+func (s *sqlStore) checkRecipientCaps(tx *sql.Tx, allowance *Allowance, grants []*Grant) error {
+	if len(allowance.RecipientCaps) == 0 {
+		return nil
+	}
+
+	recipients := make([]int64, 0, len(grants))
+	requested := make(map[int64]int)
+	for _, grant := range grants {
+		if _, ok := requested[grant.Recipient]; !ok {
+			recipients = append(recipients, grant.Recipient)
+		}
+		requested[grant.Recipient] += int(grant.Points)
+	}
+
+	for _, recipient := range recipients {
+		for _, limit := range allowance.RecipientCaps {
+			var used int
+			err := s.queryRow(tx, `
+				SELECT COALESCE(SUM(points), 0)
+				FROM kudos_grants
+				WHERE sender = ?
+					AND recipient = ?
+					AND created_at >= ?
+					AND revoked_at IS NULL
+					AND NOT by_admin
+			`, allowance.Sender, recipient, limit.Since).Scan(&used)
+			if err != nil {
+				return err
+			}
+
+			if used+requested[recipient] > limit.Limit {
+				return &RecipientCapError{Recipient: recipient, Cap: limit, Used: used, Requested: requested[recipient]}
+			}
+		}
+	}
+	return nil
+}
+
+// spendPeriod adds the points to what the user has given in the allowance's current period. Returns what they had
+// given in the period before, and how much they can give in it including anything carried over. The rate row is
+// moved on to the current period the first time the user gives kudos in it.
+func (s *sqlStore) spendPeriod(tx *sql.Tx, allowance *Allowance, points int) (int, int, error) {
+	period := rateDay(allowance.Since, allowance.Since.Location())
+
+	// The date is read back as text, drivers which scan dates into times would otherwise move it into the server's time
+	// zone and onto the day before. Whether it's an earlier period is compared in SQL for the same reason.
+	var day string
+	var count, carried int
+	var earlier bool
+	err := s.queryRow(tx, "SELECT CAST(time AS CHAR(10)), count, carried, time < ? FROM rate WHERE user_id = ?", period,
+		allowance.Sender).Scan(&day, &count, &carried, &earlier)
+	switch {
+	case err == sql.ErrNoRows:
+		count, carried = 0, 0
+		_, err = s.exec(tx, "INSERT INTO rate (user_id, time, count, carried) VALUES (?, ?, 0, 0)", allowance.Sender,
+			period)
+	case err != nil:
+	case earlier:
+		carried = allowance.carriedOver(day, count, carried)
+		count = 0
+		_, err = s.exec(tx, "UPDATE rate SET time = ?, count = 0, carried = ? WHERE user_id = ?", period, carried,
+			allowance.Sender)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	_, err = s.exec(tx, "UPDATE rate SET count = count + ? WHERE user_id = ?", points, allowance.Sender)
+	return count, allowance.Limit + carried, err
+}
+
+// sentSince counts how many points worth of kudos the user has given since the given time, leaving out revoked
+// grants and grants made by admins. Only the kudos taken from the channel's own allowance are counted if it's set,
+// otherwise only the kudos taken from the global allowance are.
+func (s *sqlStore) sentSince(tx *sql.Tx, userId int64, channel string, since time.Time) (int, error) {
+	var count int
+	var err error
+	if channel != "" {
+		err = s.queryRow(tx, `
+			SELECT COALESCE(SUM(points), 0)
+			FROM kudos_grants
+			WHERE sender = ?
+				AND channel = ?
+				AND created_at >= ?
+				AND revoked_at IS NULL
+				AND NOT by_admin
+				AND channel_allowance
+		`, userId, channel, since).Scan(&count)
+	} else {
+		err = s.queryRow(tx, `
+			SELECT COALESCE(SUM(points), 0)
+			FROM kudos_grants
+			WHERE sender = ?
+				AND created_at >= ?
+				AND revoked_at IS NULL
+				AND NOT by_admin
+				AND NOT channel_allowance
+		`, userId, since).Scan(&count)
+	}
+	return count, err
+}
+
+func (s *sqlStore) GrantsForMessage(channel string, messageTs string) ([]*Grant, error) {
+	rows, err := s.query(s.db, `
+		SELECT id, sender, recipient, emoji, count, points, created_at, channel_allowance
+		FROM kudos_grants
+		WHERE channel = ?
+			AND message_ts = ?
+			AND revoked_at IS NULL
+		ORDER BY id
+	`, channel, messageTs)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseRows(rows)
+
+	grants := make([]*Grant, 0)
+	for rows.Next() {
+		grant := Grant{Channel: channel, MessageTs: messageTs}
+		err = rows.Scan(&grant.Id, &grant.Sender, &grant.Recipient, &grant.Emoji, &grant.Count, &grant.Points,
+			&grant.CreatedAt, &grant.ChannelAllowance)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, &grant)
+	}
+
+	return grants, rows.Err()
+}
+
+func (s *sqlStore) ReactionGrant(sender int64, recipient int64, emoji string, channel string, messageTs string) (*Grant, error) {
+	grant := Grant{Sender: sender, Recipient: recipient, Emoji: emoji, Channel: channel, MessageTs: messageTs}
+	err := s.queryRow(s.db, `
+		SELECT id, count, points, created_at, channel_allowance
+		FROM kudos_grants
+		WHERE sender = ?
+			AND recipient = ?
+			AND emoji = ?
+			AND channel = ?
+			AND message_ts = ?
+			AND revoked_at IS NULL
+		ORDER BY id DESC
+		LIMIT 1
+	`, sender, recipient, emoji, channel, messageTs).Scan(&grant.Id, &grant.Count, &grant.Points, &grant.CreatedAt,
+		&grant.ChannelAllowance)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+func (s *sqlStore) RevokeGrant(grant *Grant, refund *Allowance) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := s.revokeGrant(tx, grant, refund)
+	if err != nil || !ok {
+		_ = tx.Rollback()
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		grant.RevokedAt = nil
+		return false, err
+	}
+	return true, nil
+}
+
+// revokeGrant marks the grant as revoked, removes it from the kudos totals and refunds the allowance as part of the
+// transaction. Returns false if the grant had already been revoked.
+func (s *sqlStore) revokeGrant(tx *sql.Tx, grant *Grant, refund *Allowance) (bool, error) {
+	now := time.Now()
+	res, err := s.exec(tx, "UPDATE kudos_grants SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", now, grant.Id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, err
+	}
+
+	_, err = s.exec(tx, `
+		UPDATE kudos
+		SET count = count - ?,
+			points = points - ?
+		WHERE sender = ?
+			AND recipient = ?
+			AND emoji = ?
+	`, grant.Count, grant.Points, grant.Sender, grant.Recipient, grant.Emoji)
+	if err != nil {
+		return false, err
+	}
+
+	// Rolling allowances are counted from the ledger, so revoking the grant is all it takes to refund it. Otherwise the
+	// allowance is only refunded if it hasn't been reset since, which is when the rate row is still for the period the
+	// grant was given in.
+	if refund != nil && !refund.Rolling {
+		_, err = s.exec(tx, `
+			UPDATE rate
+			SET count = CASE WHEN count > ? THEN count - ? ELSE 0 END
+			WHERE user_id = ?
+				AND time = ?
+		`, grant.Points, grant.Points, grant.Sender, rateDay(refund.Since, refund.Since.Location()))
+		if err != nil {
+			return false, err
+		}
+	}
+
+	grant.RevokedAt = &now
+	return true, nil
+}
+
+func (s *sqlStore) AdjustKudos(action *AdminAction, grant *Grant) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	count, points, err := s.pairTotal(tx, grant.Sender, grant.Recipient, grant.Emoji)
+	if err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+
+	// The totals can't go below zero
+	if count+grant.Count < 0 || points+grant.Points < 0 {
+		grant.Count, grant.Points = -count, -points
+	}
+	if grant.Count == 0 && grant.Points == 0 {
+		_ = tx.Rollback()
+		return false, nil
+	}
+
+	grant.ByAdmin = true
+	if err = s.recordGrant(tx, grant); err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+
+	action.Sender, action.Recipient, action.Emoji, action.GrantId = grant.Sender, grant.Recipient, grant.Emoji, grant.Id
+	action.CountBefore, action.PointsBefore = count, points
+	action.CountAfter, action.PointsAfter = count+grant.Count, points+grant.Points
+	if err = s.logAdminAction(tx, action); err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (s *sqlStore) VoidGrant(action *AdminAction, grant *Grant, refund *Allowance) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	count, points, err := s.pairTotal(tx, grant.Sender, grant.Recipient, grant.Emoji)
+	if err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+
+	ok, err := s.revokeGrant(tx, grant, refund)
+	if err != nil || !ok {
+		_ = tx.Rollback()
+		return false, err
+	}
+
+	action.Sender, action.Recipient, action.Emoji, action.GrantId = grant.Sender, grant.Recipient, grant.Emoji, grant.Id
+	action.CountBefore, action.PointsBefore = count, points
+	action.CountAfter, action.PointsAfter = count-grant.Count, points-grant.Points
+	if err = s.logAdminAction(tx, action); err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		grant.RevokedAt = nil
+		return false, err
+	}
+	return true, nil
+}
+
+// pairTotal returns the count and points of all the kudos the sender has given the recipient with the emoji
+func (s *sqlStore) pairTotal(tx *sql.Tx, sender int64, recipient int64, emoji string) (int64, int64, error) {
+	var count, points int64
+	err := s.queryRow(tx, "SELECT count, points FROM kudos WHERE sender = ? AND recipient = ? AND emoji = ?", sender,
+		recipient, emoji).Scan(&count, &points)
+	if err == sql.ErrNoRows {
+		return 0, 0, nil
+	}
+	return count, points, err
+}
+
+// logAdminAction appends the action to the admin log as part of the transaction. The action's id and creation time
+// are filled in.
+func (s *sqlStore) logAdminAction(tx *sql.Tx, action *AdminAction) error {
+	action.CreatedAt = time.Now()
+	grantId := sql.NullInt64{Int64: action.GrantId, Valid: action.GrantId != 0}
+
+	var err error
+	action.Id, err = s.insert(tx, `
+		INSERT INTO admin_log (admin, action, sender, recipient, emoji, grant_id, reason, count_before, count_after,
+			points_before, points_after, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, action.Admin, action.Action, action.Sender, action.Recipient, action.Emoji, grantId, nullString(action.Reason),
+		action.CountBefore, action.CountAfter, action.PointsBefore, action.PointsAfter, action.CreatedAt)
+	return err
+}
+
+func (s *sqlStore) AdminLog(limit int) ([]*AdminAction, error) {
+	rows, err := s.query(s.db, `
+		SELECT l.id, l.admin, au.username, l.action, l.sender, su.username, l.recipient, ru.username, l.emoji,
+			l.grant_id, l.reason, l.count_before, l.count_after, l.points_before, l.points_after, l.created_at
+		FROM admin_log l
+			INNER JOIN users au ON l.admin = au.id
+			INNER JOIN users su ON l.sender = su.id
+			INNER JOIN users ru ON l.recipient = ru.id
+		ORDER BY l.id DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseRows(rows)
+
+	actions := make([]*AdminAction, 0)
+	for rows.Next() {
+		action := AdminAction{}
+		var grantId sql.NullInt64
+		var reason sql.NullString
+		err = rows.Scan(&action.Id, &action.Admin, &action.AdminName, &action.Action, &action.Sender,
+			&action.SenderName, &action.Recipient, &action.RecipientName, &action.Emoji, &grantId, &reason,
+			&action.CountBefore, &action.CountAfter, &action.PointsBefore, &action.PointsAfter, &action.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		action.GrantId, action.Reason = grantId.Int64, reason.String
+		actions = append(actions, &action)
+	}
+
+	return actions, rows.Err()
+}
+
+func (s *sqlStore) Leaderboard(emojis []string, window *TimeWindow, received bool) ([]*UserCount, error) {
+	var target string
+	if received {
+		target = "k.recipient"
+	} else {
+		target = "k.sender"
+	}
+
+	// All time counts come straight from the totals, anything narrower has to be summed from the ledger. Totals which
+	// were all withdrawn again are left out.
+	table := "kudos"
+	conds := []string{"k.count > 0"}
+	args := make([]interface{}, 0)
+	if window != nil {
+		table = "kudos_grants"
+		conds, args = windowConditions(window)
+	}
+
+	// sum all emojis when not specified
+	if len(emojis) != 0 {
+		conds = append(conds, fmt.Sprintf("k.emoji IN (%v)", createParams(emojis)))
+		args = append(args, generify(emojis)...)
+	}
+
+	var where string
+	if len(conds) != 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	rows, err := s.query(s.db, fmt.Sprintf(`
+		SELECT u.username, SUM(k.points)
+		FROM %v k
+			INNER JOIN users u ON %v = u.id
+		%v
+		GROUP BY u.username
+		ORDER BY SUM(k.points) DESC, u.username DESC
+		LIMIT 10
+	`, table, target, where), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseRows(rows)
+
+	userCounts := make([]*UserCount, 0, 10)
+	for rows.Next() {
+		userCount := UserCount{}
+		err = rows.Scan(&userCount.Username, &userCount.Points)
+		if err != nil {
+			return nil, err
+		}
+
+		userCounts = append(userCounts, &userCount)
+	}
+
+	return userCounts, rows.Err()
+}
+
+func (s *sqlStore) Stats(userId int64, emojis []string, window *TimeWindow, received bool) ([]*KudosRow, error) {
+	var target string
+	var join string
+	if received {
+		join = "k.sender"
+		target = "k.recipient"
+	} else {
+		join = "k.recipient"
+		target = "k.sender"
+	}
+
+	conds := []string{fmt.Sprintf("%s = ?", target)}
+	args := []interface{}{userId}
+	if len(emojis) != 0 {
+		conds = append(conds, fmt.Sprintf("k.emoji IN (%s)", createParams(emojis)))
+		args = append(args, generify(emojis)...)
+	}
+
+	var rows *sql.Rows
+	var err error
+	if window == nil {
+		// Totals which were all withdrawn again are left out
+		conds = append(conds, "k.count > 0")
+		rows, err = s.query(s.db, fmt.Sprintf(`
+			SELECT %s, k.emoji, k.count, k.points, u.username
+			FROM kudos k
+				INNER JOIN users u ON %s = u.id
+			WHERE %s
+			ORDER BY k.points DESC, u.username DESC
+		`, join, join, strings.Join(conds, " AND ")), args...)
+	} else {
+		// The ledger has a row per grant, so the grants within the window have to be summed up per user and emoji
+		windowConds, windowArgs := windowConditions(window)
+		conds = append(conds, windowConds...)
+		args = append(args, windowArgs...)
+		rows, err = s.query(s.db, fmt.Sprintf(`
+			SELECT %s, k.emoji, SUM(k.count), SUM(k.points), u.username
+			FROM kudos_grants k
+				INNER JOIN users u ON %s = u.id
+			WHERE %s
+			GROUP BY %s, k.emoji, u.username
+			ORDER BY SUM(k.points) DESC, u.username DESC
+		`, join, join, strings.Join(conds, " AND "), join), args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer CloseRows(rows)
+
+	kudosRows := make([]*KudosRow, 0)
+	for rows.Next() {
+		kudosRow := KudosRow{}
+		err = rows.Scan(&kudosRow.SenderId, &kudosRow.Emoji, &kudosRow.Count, &kudosRow.Points, &kudosRow.SenderName)
+		if err != nil {
+			return nil, err
+		}
+		kudosRows = append(kudosRows, &kudosRow)
+	}
+
+	return kudosRows, rows.Err()
+}
+
+func (s *sqlStore) PairTotals() ([]*PairTotal, error) {
+	rows, err := s.query(s.db, `
+		SELECT k.sender, su.username, k.recipient, ru.username, SUM(k.points)
+		FROM kudos k
+			INNER JOIN users su ON k.sender = su.id
+			INNER JOIN users ru ON k.recipient = ru.id
+		GROUP BY k.sender, su.username, k.recipient, ru.username
+		HAVING SUM(k.points) > 0
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer CloseRows(rows)
+
+	totals := make([]*PairTotal, 0)
+	for rows.Next() {
+		total := PairTotal{}
+		err = rows.Scan(&total.Sender, &total.SenderName, &total.Recipient, &total.RecipientName, &total.Points)
+		if err != nil {
+			return nil, err
+		}
+		totals = append(totals, &total)
+	}
+
+	return totals, rows.Err()
+}
+
+func (s *sqlStore) RenameEmoji(oldName string, newName string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(tx, "UPDATE kudos_grants SET emoji = ? WHERE emoji = ?", newName, oldName)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	// The totals are unique per emoji, so they're added to any totals for the new name rather than renamed
+	rows, err := s.query(tx, "SELECT sender, recipient, count, points FROM kudos WHERE emoji = ?", oldName)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	type total struct {
+		sender, recipient, count, points int64
+	}
+	totals := make([]total, 0)
+	for rows.Next() {
+		t := total{}
+		if err = rows.Scan(&t.sender, &t.recipient, &t.count, &t.points); err != nil {
+			CloseRows(rows)
+			_ = tx.Rollback()
+			return err
+		}
+		totals = append(totals, t)
+	}
+	CloseRows(rows)
+	if err = rows.Err(); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	for _, t := range totals {
+		_, err = s.exec(tx, s.dialect.addKudos, t.sender, t.recipient, newName, t.count, t.points)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = s.exec(tx, "DELETE FROM kudos WHERE emoji = ?", oldName)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+// windowConditions returns the SQL conditions and their parameters which limit kudos_grants (aliased as k) to the
+// grants in the window which haven't been revoked
+func windowConditions(window *TimeWindow) ([]string, []interface{}) {
+	conds := []string{"k.revoked_at IS NULL"}
+	args := make([]interface{}, 0, 2)
+	if !window.Start.IsZero() {
+		conds = append(conds, "k.created_at >= ?")
+		args = append(args, window.Start)
+	}
+	if !window.End.IsZero() {
+		conds = append(conds, "k.created_at < ?")
+		args = append(args, window.End)
+	}
+	return conds, args
+}
+
+// nullString maps empty strings to SQL NULL, for optional columns such as the channel and message of a grant
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func CloseRows(rows *sql.Rows) {
+	if rows == nil {
+		return
+	}
+	_ = rows.Close()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"database/sql"
+	_ "github.com/mattn/go-sqlite3"
+	"log"
+	"net/url"
+)
+
+// The rate date is compared as text in SQLite, which works because it's always given in the YYYY-MM-DD format. Times
+// are compared as text as well, so they're always stored in UTC.
+var sqliteDialect = &dialect{
+	name:     DriverSqlite,
+	utcTimes: true,
+	schemaVersionTable: `
+		CREATE TABLE IF NOT EXISTS schema_version
+		(
+		  version    INT PRIMARY KEY NOT NULL,
+		  name       VARCHAR(255)    NOT NULL,
+		  applied_at DATETIME DEFAULT CURRENT_TIMESTAMP NOT NULL
+		)
+	`,
+	enableChannel: `
+		INSERT INTO enabled_channels (name, enabled)
+		VALUES (?, TRUE)
+		ON CONFLICT (name) DO UPDATE SET
+			enabled = TRUE
+	`,
+	saveChannel: `
+		INSERT INTO enabled_channels (name, enabled, allowance, emojis, announce)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			allowance = excluded.allowance,
+			emojis = excluded.emojis,
+			announce = excluded.announce
+	`,
+	addKudos: `
+		INSERT INTO kudos (sender, recipient, emoji, count, points)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (sender, recipient, emoji) DO UPDATE SET
+			count = count + excluded.count,
+			points = points + excluded.points
+	`,
+}
+
+// newSqliteStore opens the SQLite database file at the configured path, creating it if it doesn't exist
+func newSqliteStore(conf DbConfig) (Store, error) {
+	params := url.Values{}
+	params.Set("_loc", "auto")
+	params.Set("_foreign_keys", "1")
+	params.Set("_busy_timeout", "5000")
+	dsn := "file:" + conf.Path + "?" + params.Encode()
+
+	log.Printf("Using SQLite database %v\n", conf.Path)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows a single writer at a time, so every query shares one connection instead of fighting over locks
+	db.SetMaxOpenConns(1)
+
+	return &sqlStore{db, sqliteDialect}, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestStore opens a fresh SQLite database with every migration applied
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+	store, err := DbConfig{Driver: DriverSqlite, Path: filepath.Join(t.TempDir(), "kudos.db")}.Connect()
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	if err := store.Migrate(); err != nil {
+		t.Fatalf("failed to migrate store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = store.Close()
+	})
+	return store
+}
+
+// inLocalZone runs the rest of the test as if the server's local time zone was loc
+func inLocalZone(t *testing.T, loc *time.Location) {
+	local := time.Local
+	time.Local = loc
+	t.Cleanup(func() {
+		time.Local = local
+	})
+}
+
+// mustLoadLocation loads the time zone or fails the test
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("failed to load time zone %v: %v", name, err)
+	}
+	return loc
+}
+
+// mustCreateUser adds the user to the store or fails the test
+func mustCreateUser(t *testing.T, store Store, slackId string, username string, tz string) *User {
+	t.Helper()
+	user, err := store.CreateUser(slackId, username, tz)
+	if err != nil {
+		t.Fatalf("failed to create %v: %v", username, err)
+	}
+	return user
+}
+
+func TestGrantTimesAreComparedAcrossTimeZones(t *testing.T) {
+	inLocalZone(t, time.UTC)
+	store := newTestStore(t)
+	alice := mustCreateUser(t, store, "UALICE", "alice", "Asia/Tokyo")
+	bob := mustCreateUser(t, store, "UBOB", "bob", "America/Chicago")
+	carol := mustCreateUser(t, store, "UCAROL", "carol", "")
+	now := time.Now()
+
+	// alice is ahead of the server, the grant she gave 20 hours ago is still inside her 24 hour window
+	rolling := func(at time.Time) *Allowance {
+		return &Allowance{
+			Sender:  alice.Id,
+			Limit:   1,
+			Since:   at.Add(-24 * time.Hour).In(alice.Location()),
+			Period:  24 * time.Hour,
+			Rolling: true,
+		}
+	}
+	earlier := &Grant{Sender: alice.Id, Recipient: carol.Id, Emoji: "taco", Count: 1, Points: 1, Channel: "CGENERAL",
+		CreatedAt: now.Add(-20 * time.Hour)}
+	if _, err := store.GiveGrants(rolling(earlier.CreatedAt), []*Grant{earlier}); err != nil {
+		t.Fatalf("failed to give the first grant: %v", err)
+	}
+	again := &Grant{Sender: alice.Id, Recipient: carol.Id, Emoji: "taco", Count: 1, Points: 1, Channel: "CGENERAL"}
+	_, err := store.GiveGrants(rolling(now), []*Grant{again})
+	if limit, ok := err.(*AllowanceError); !ok || limit.Used != 1 {
+		t.Errorf("expected alice's second grant to be rejected with 1 used, got %v", err)
+	}
+
+	// bob is behind the server, a grant given just before his day started doesn't count towards today
+	channel := func(at time.Time) *Allowance {
+		return &Allowance{
+			Sender:  bob.Id,
+			Limit:   1,
+			Channel: "CGENERAL",
+			Since:   startOfDay(at, bob.Location()),
+			Period:  24 * time.Hour,
+		}
+	}
+	yesterday := &Grant{Sender: bob.Id, Recipient: carol.Id, Emoji: "taco", Count: 1, Points: 1, Channel: "CGENERAL",
+		CreatedAt: startOfDay(now, bob.Location()).Add(-time.Hour).Local()}
+	if _, err := store.GiveGrants(channel(yesterday.CreatedAt), []*Grant{yesterday}); err != nil {
+		t.Fatalf("failed to give yesterday's grant: %v", err)
+	}
+	today := &Grant{Sender: bob.Id, Recipient: carol.Id, Emoji: "taco", Count: 1, Points: 1, Channel: "CGENERAL"}
+	if left, err := store.GiveGrants(channel(now), []*Grant{today}); err != nil || left != 0 {
+		t.Errorf("expected bob's grant today to use his whole allowance, got %v left (%v)", left, err)
+	}
+	_, err = store.GiveGrants(channel(now), []*Grant{{Sender: bob.Id, Recipient: carol.Id, Emoji: "taco", Count: 1,
+		Points: 1, Channel: "CGENERAL"}})
+	if _, ok := err.(*AllowanceError); !ok {
+		t.Errorf("expected bob's second grant today to be rejected, got %v", err)
+	}
+}
+
+// migrateTo applies the migrations which haven't been applied yet up to and including the version, like an older
+// version of HeyKudos would have
+func migrateTo(t *testing.T, store Store, version int) {
+	t.Helper()
+	s := store.(*sqlStore)
+	migrations, err := loadMigrations(s.dialect.name)
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err = s.exec(s.db, s.dialect.schemaVersionTable); err != nil {
+		t.Fatalf("failed to create schema_version: %v", err)
+	}
+	var current int
+	if err = s.queryRow(s.db, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current); err != nil {
+		t.Fatalf("failed to find the schema version: %v", err)
+	}
+	for _, m := range migrations {
+		if m.version > current && m.version <= version {
+			if err = s.apply(m); err != nil {
+				t.Fatalf("migration %v failed: %v", m.version, err)
+			}
+		}
+	}
+}
+
+func TestSeededGrantsAreLeftOutOfWindows(t *testing.T) {
+	store, err := DbConfig{Driver: DriverSqlite, Path: filepath.Join(t.TempDir(), "kudos.db")}.Connect()
+	if err != nil {
+		t.Fatalf("failed to open store: %v", err)
+	}
+	defer store.Close()
+	s := store.(*sqlStore)
+
+	migrateTo(t, store, 1)
+	for _, statement := range []string{
+		"INSERT INTO users (id, slack_id, username) VALUES (1, 'UALICE', 'alice'), (2, 'UBOB', 'bob')",
+		"INSERT INTO kudos (sender, recipient, emoji, count) VALUES (1, 2, 'taco', 7)",
+	} {
+		if _, err = s.db.Exec(statement); err != nil {
+			t.Fatalf("failed to fill the old database: %v", err)
+		}
+	}
+	if err = store.Migrate(); err != nil {
+		t.Fatalf("failed to migrate store: %v", err)
+	}
+
+	all, err := store.Leaderboard(nil, nil, true)
+	if err != nil || len(all) != 1 || all[0].Username != "bob" || all[0].Points != 7 {
+		t.Errorf("expected bob to have 7 points of all time, got %+v (%v)", all, err)
+	}
+	year := &TimeWindow{Name: "year", Start: time.Now().AddDate(-1, 0, 0)}
+	windowed, err := store.Leaderboard(nil, year, true)
+	if err != nil || len(windowed) != 0 {
+		t.Errorf("expected the copied kudos to be left out of the last year, got %+v (%v)", windowed, err)
+	}
+}
@@ -1,97 +1,248 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
 	"github.com/nlopes/slack"
 	"github.com/pkg/errors"
 	"log"
 	"strings"
+	"time"
 )
 
 type User struct {
 	Id       int64
 	SlackId  string
 	Username string
+	// Tz is the time zone from the user's Slack profile, empty if it isn't known
+	Tz string
 }
 
-func GetUser(username string, rtm *slack.RTM, db *sql.DB) (*User, error) {
-	rows, err := db.Query("SELECT id, slack_id, username FROM users WHERE slack_id = ?", username)
+// userTzTtl is how long a user's stored time zone is trusted before it's checked against their Slack profile again,
+// since it changes when people travel
+const userTzTtl = 24 * time.Hour
+
+var (
+	// checkedUserTzs remembers which users' time zones have been checked against their Slack profiles recently
+	checkedUserTzs = newCache("user time zone", userTzTtl)
+	// locations caches the time zones which have been loaded, by name
+	locations = newCache("location", 0)
+)
+
+// Location returns the user's time zone, which is where their day starts and ends
+func (u *User) Location() *time.Location {
+	return userLocation(u.Tz)
+}
+
+// userLocation loads the named time zone, falling back to the server's time zone if it's empty or unknown
+func userLocation(tz string) *time.Location {
+	if tz == "" {
+		return time.Local
+	}
+	if loc, ok := locations.Get(tz); ok {
+		return loc.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		log.Printf("Unknown time zone %v, using the local time zone instead: %v\n", tz, err)
+		loc = time.Local
+	}
+	locations.Set(tz, loc)
+	return loc
+}
+
+func GetUser(username string, api Chat, store Store) (*User, error) {
+	user, err := store.UserBySlackId(username)
 	if err != nil {
 		return nil, err
 	}
-	defer CloseRows(rows)
+	if user != nil {
+		checkUserTz(user, api, store)
+		return user, nil
+	}
 
-	if rows.Next() {
-		user := User{}
-		err = rows.Scan(&user.Id, &user.SlackId, &user.Username)
-		if err != nil {
-			return nil, err
-		}
-		return &user, nil
-	} else {
-		info, err := rtm.GetUserInfo(username)
-		if err != nil {
-			return nil, err
-		}
+	info, err := api.GetUserInfo(username)
+	if err != nil {
+		return nil, err
+	}
 
-		user := User{0, info.ID, info.Name}
-		res, err := db.Exec("INSERT INTO users (slack_id, username) VALUES (?, ?)", info.ID, info.Name)
-		if err != nil {
-			return nil, userInsertError(info, err)
+	user, err = store.CreateUser(info.ID, info.Name, info.TZ)
+	if err != nil {
+		// Another message from the same new user may have created them in the meantime
+		if existing, _ := store.UserBySlackId(info.ID); existing != nil {
+			return existing, nil
 		}
+		return nil, userInsertError(info, err)
+	}
 
-		id, err := res.LastInsertId()
-		if err != nil {
-			return nil, userInsertError(info, err)
-		}
+	checkedUserTzs.Set(user.SlackId, true)
+	return user, nil
+}
 
-		user.Id = id
+// checkUserTz updates the user's stored time zone from their Slack profile, if it hasn't been checked recently. If
+// Slack can't be reached the stored time zone is used as it is.
+func checkUserTz(user *User, api Chat, store Store) {
+	if _, ok := checkedUserTzs.Get(user.SlackId); ok {
+		return
+	}
 
-		return &user, nil
+	info, err := api.GetUserInfo(user.SlackId)
+	if err != nil {
+		log.Printf("Failed to get the time zone of %v: %v\n", user.Username, err)
+		return
 	}
+	checkedUserTzs.Set(user.SlackId, true)
+	if info.TZ == user.Tz {
+		return
+	}
+
+	log.Printf("Changing time zone of %v from %q to %q\n", user.Username, user.Tz, info.TZ)
+	if err = store.SetUserTz(user.Id, info.TZ); err != nil {
+		log.Printf("Failed to change time zone of %v: %v\n", user.Username, err)
+		return
+	}
+	user.Tz = info.TZ
 }
 
 func userInsertError(info *slack.User, err error) error {
 	return errors.Wrap(err, fmt.Sprintf("failed to insert new user %v, slack_id %v", info.Name, info.ID))
 }
 
-func GiveKudos(from *User, to *User, db *sql.DB, rtm *slack.RTM, ev *slack.MessageEvent, left int, emojis ...string) {
-	emojiCounts := make(map[string]int64)
-	for _, emoji := range emojis {
-		emojiCounts[emoji] += 1
+// Gift is the kudos a message gives to one of its recipients
+type Gift struct {
+	To     *User
+	Emojis []string
+}
+
+// GiveKudos records the kudos a message gives to each of its recipients and lets everyone know. The sender's allowance
+// has to cover all of them, otherwise none are given. The channel and message timestamp identify the message the kudos
+// were given in, either by the message itself or by a reaction to it.
+func GiveKudos(from *User, gifts []*Gift, store Store, api Chat, channel string, messageTs string) {
+	settings := getChannelSettings(channel, store)
+	if settings == nil {
+		return
 	}
 
-	successfulSends := make([]*Sent, 0, len(emojiCounts))
+	now := time.Now()
+	policy := BotConfig.Policy()
+	allowance := policy.Allowance(from, now)
+	allowance.RecipientCaps = BotConfig.RecipientCaps.caps(from, now)
+	where := ""
+	if settings.Allowance > 0 {
+		allowance.Limit = settings.Allowance
+		allowance.Cap = 0
+		allowance.Channel = channel
+		where = " in this channel"
+	}
 
-	for emoji, count := range emojiCounts {
-		_, err := db.Exec(`
-			INSERT INTO kudos (sender, recipient, emoji, count)
-			VALUES (?, ?, ?, ?)
-			ON DUPLICATE KEY UPDATE
-				count = count + ?
-		`, from.Id, to.Id, emoji, count, count)
+	grants := make([]*Grant, 0, len(gifts))
+	sends := make([][]*Sent, len(gifts))
+	for i, gift := range gifts {
+		sends[i] = countEmojis(gift.Emojis)
+		for _, send := range sends[i] {
+			grants = append(grants, &Grant{
+				Sender:    from.Id,
+				Recipient: gift.To.Id,
+				Emoji:     send.Emoji,
+				Count:     send.Count,
+				Points:    send.Count * int64(BotConfig.EmojiWeight(send.Emoji)),
+				Channel:   channel,
+				MessageTs: messageTs,
+			})
+		}
+	}
 
-		if err != nil {
-			failGivingKudos(from, to, rtm, err)
+	left, err := store.GiveGrants(allowance, grants)
+	if limit, ok := err.(*AllowanceError); ok {
+		rateLimited(from, limit, allowance, policy, where, api)
+		return
+	}
+	if limit, ok := err.(*RecipientCapError); ok {
+		recipientCapped(from, gifts, limit, api)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to give kudos from %v: %v\n", from.Username, err)
+		SendMessage(from, "Sorry, something went wrong while trying to give your kudos, so none of them were given.", api)
+		return
+	}
+
+	leftString := leftIn(left, policy, where)
+
+	for i, gift := range gifts {
+		to := gift.To
+		giveString := createGiveString(sends[i])
+		SendMessage(from, fmt.Sprintf("You just sent the following kudos to `%v`: (%v). %v", to.Username, giveString, leftString), api)
+
+		if settings.Announce {
+			announceKudos(from, to, channel, giveString, api)
+		}
+
+		// Kudos given with a slash command don't have a message to link to
+		if messageTs == "" {
+			SendMessage(to, fmt.Sprintf("You just received kudos (%v) from `%v`!", giveString, from.Username), api)
 			continue
 		}
 
-		successfulSends = append(successfulSends, &Sent{emoji, count})
+		urlTemplate := "https://%v.slack.com/archives/%v/p%v"
+		url := fmt.Sprintf(urlTemplate, DomainText, channel, strings.Replace(messageTs, ".", "", 1))
+		SendMessage(to, fmt.Sprintf("You just received kudos (%v) from `%v`! (%v)", giveString, from.Username, url), api)
+	}
+}
+
+// recipientCapped lets the sender know their kudos weren't given because they would give one of the recipients more than
+// they're allowed to
+func recipientCapped(from *User, gifts []*Gift, limit *RecipientCapError, api Chat) {
+	var to *User
+	for _, gift := range gifts {
+		if gift.To.Id == limit.Recipient {
+			to = gift.To
+		}
+	}
+	if to == nil {
+		return
 	}
 
-	giveString := createGiveString(successfulSends)
-	var leftString string
-	if left == 0 {
-		leftString = "You don't have any kudos left to give today."
+	log.Printf("%v capped from giving %v more kudos\n", from.Username, to.Username)
+	var given string
+	if limit.Used == 0 {
+		given = fmt.Sprintf("you tried to give them %v", limit.Requested)
 	} else {
-		leftString = fmt.Sprintf("You have %v kudos left to give today.", left)
+		period := "this " + limit.Cap.Period
+		if limit.Cap.Period == "day" {
+			period = "today"
+		}
+		given = fmt.Sprintf("you've already given them %v %v and tried to give them %v more", limit.Used, period,
+			limit.Requested)
 	}
-	SendMessage(from, fmt.Sprintf("You just sent the following kudos to `%v`: (%v). %v", to.Username, giveString, leftString), rtm)
+	SendMessage(from, fmt.Sprintf("Sorry, you can only give `%v` %v kudos per %v, but %v. None of your kudos were "+
+		"sent. Your kudos for `%v` reset %v.", to.Username, limit.Cap.Limit, limit.Cap.Period, given, to.Username,
+		formatResetTime(limit.Cap.Resets())), api)
+}
 
-	urlTemplate := "https://%v.slack.com/archives/%v/p%v"
-	url := fmt.Sprintf(urlTemplate, DomainText, ev.Channel, strings.Replace(ev.Msg.Timestamp, ".", "", 1))
-	SendMessage(to, fmt.Sprintf("You just received kudos (%v) from `%v`! (%v)", giveString, from.Username, url), rtm)
+// countEmojis counts how many of each emoji are given, in the order they were first given
+func countEmojis(emojis []string) []*Sent {
+	sends := make([]*Sent, 0, len(emojis))
+	counts := make(map[string]*Sent)
+	for _, emoji := range emojis {
+		if send, ok := counts[emoji]; ok {
+			send.Count++
+			continue
+		}
+		send := &Sent{Emoji: emoji, Count: 1}
+		counts[emoji] = send
+		sends = append(sends, send)
+	}
+	return sends
+}
+
+// announceKudos lets the channel the kudos were given in know about them
+func announceKudos(from *User, to *User, channel string, giveString string, api Chat) {
+	_, _, err := api.PostMessage(channel, slack.MsgOptionUsername(BotUsername),
+		slack.MsgOptionText(fmt.Sprintf("`%v` just gave `%v` kudos: %v", from.Username, to.Username, giveString), false))
+	if err != nil {
+		log.Printf("Failed to announce kudos in %v: %v\n", channel, err)
+	}
 }
 
 type Sent struct {
@@ -112,13 +263,8 @@ func createGiveString(sends []*Sent) string {
 	return builder.String()
 }
 
-func failGivingKudos(from *User, to *User, rtm *slack.RTM, err error) {
-	log.Printf("Failed to give kudos to %v from %v: %v\n", from.Username, to.Username, err)
-	SendMessage(from, fmt.Sprintf("Sorry, something went wrong while trying to give %v kudos", to.Username), rtm)
-}
-
-func SendMessage(user *User, message string, rtm *slack.RTM) {
-	slackUser, err := rtm.GetUserInfo(user.SlackId)
+func SendMessage(user *User, message string, api Chat) {
+	slackUser, err := api.GetUserInfo(user.SlackId)
 	if err != nil {
 		log.Printf("Failed to get user info for %v: %v", user.Username, err)
 		return
@@ -127,14 +273,14 @@ func SendMessage(user *User, message string, rtm *slack.RTM) {
 		return
 	}
 
-	_, _, channelId, err := rtm.OpenIMChannel(user.SlackId)
+	_, _, channelId, err := api.OpenIMChannel(user.SlackId)
 	if err != nil {
 		log.Printf("Failed to open channel to user %v: %v", user.Username, err)
 		return
 	}
 
 	log.Printf("Attempting to send the following message to %v: %v\n", user.Username, message)
-	_, _, err = rtm.PostMessage(channelId, slack.MsgOptionText(message, false))
+	_, _, err = api.PostMessage(channelId, slack.MsgOptionText(message, false))
 
 	if err != nil {
 		log.Printf("Failed to send message to user %v: %v", user.Username, err)
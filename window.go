@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const windowDateLayout = "2006-01-02"
+
+// TimeWindow restricts leaderboards and stats to kudos given between Start (inclusive) and End (exclusive). A nil
+// *TimeWindow means all time.
+type TimeWindow struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+// WindowMatch finds the time window requested in a leaderboard or stats command, if any. The supported forms are
+// `today`, `week`, `month`, `quarter`, `year`, `since <date>`, `until <date>`, `<date> to <date>` and `<date>..<date>`,
+// with dates written as YYYY-MM-DD. Explicit end dates are inclusive. Days start at midnight in the user's time zone,
+// the same as their allowance.
+func WindowMatch(req *Request, user *User) (*TimeWindow, error) {
+	return parseTimeWindow(strings.Fields(strings.ToLower(req.Text)), time.Now().In(user.Location()))
+}
+
+func parseTimeWindow(words []string, now time.Time) (*TimeWindow, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tomorrow := today.AddDate(0, 0, 1)
+
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		switch word {
+		case "today":
+			return &TimeWindow{"today", today, tomorrow}, nil
+		case "week":
+			// weeks start on monday
+			offset := (int(today.Weekday()) + 6) % 7
+			return &TimeWindow{"this week", today.AddDate(0, 0, -offset), tomorrow}, nil
+		case "month":
+			start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+			return &TimeWindow{"this month", start, tomorrow}, nil
+		case "quarter":
+			month := time.Month((int(now.Month())-1)/3*3 + 1)
+			start := time.Date(now.Year(), month, 1, 0, 0, 0, 0, now.Location())
+			return &TimeWindow{"this quarter", start, tomorrow}, nil
+		case "year":
+			start := time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, now.Location())
+			return &TimeWindow{"this year", start, tomorrow}, nil
+		case "since", "from", "until":
+			if i+1 >= len(words) {
+				return nil, fmt.Errorf("expected a date after `%v`", word)
+			}
+			date, err := parseWindowDate(words[i+1], now.Location())
+			if err != nil {
+				return nil, err
+			}
+			if word == "until" {
+				return &TimeWindow{"until " + words[i+1], time.Time{}, date.AddDate(0, 0, 1)}, nil
+			}
+			if i+3 < len(words) && words[i+2] == "to" {
+				return dateRange(words[i+1], words[i+3], now.Location())
+			}
+			return &TimeWindow{"since " + words[i+1], date, tomorrow}, nil
+		}
+
+		// Anything else with .. in it, such as an emoji, isn't a range
+		if index := strings.Index(word, ".."); index != -1 && isWindowDate(word[:index]) &&
+			isWindowDate(word[index+2:]) {
+			return dateRange(word[:index], word[index+2:], now.Location())
+		}
+		if i+2 < len(words) && words[i+1] == "to" && isWindowDate(word) {
+			return dateRange(word, words[i+2], now.Location())
+		}
+	}
+
+	return nil, nil
+}
+
+// dateRange creates a window covering every day from the start date through the end date
+func dateRange(startText string, endText string, loc *time.Location) (*TimeWindow, error) {
+	start, err := parseWindowDate(startText, loc)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseWindowDate(endText, loc)
+	if err != nil {
+		return nil, err
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("the end date `%v` is before the start date `%v`", endText, startText)
+	}
+	return &TimeWindow{fmt.Sprintf("%v to %v", startText, endText), start, end.AddDate(0, 0, 1)}, nil
+}
+
+func parseWindowDate(text string, loc *time.Location) (time.Time, error) {
+	date, err := time.ParseInLocation(windowDateLayout, text, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("`%v` isn't a date, dates must be written as YYYY-MM-DD", text)
+	}
+	return date, nil
+}
+
+// isWindowDate checks whether the text is a date written as YYYY-MM-DD
+func isWindowDate(text string) bool {
+	_, err := time.Parse(windowDateLayout, text)
+	return err == nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/nlopes/slack"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeWindow(t *testing.T) {
+	loc := time.UTC
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, loc)
+	}
+	// A thursday
+	now := time.Date(2026, time.October, 15, 14, 30, 0, 0, loc)
+
+	for _, test := range []struct {
+		text     string
+		now      time.Time
+		expected *TimeWindow
+	}{
+		{"leaderboard", now, nil},
+		{"leaderboard today", now, &TimeWindow{"today", date(2026, 10, 15), date(2026, 10, 16)}},
+		{"leaderboard week", now, &TimeWindow{"this week", date(2026, 10, 12), date(2026, 10, 16)}},
+		{"leaderboard month", now, &TimeWindow{"this month", date(2026, 10, 1), date(2026, 10, 16)}},
+		{"leaderboard quarter", now, &TimeWindow{"this quarter", date(2026, 10, 1), date(2026, 10, 16)}},
+		{"leaderboard quarter", date(2027, 1, 2), &TimeWindow{"this quarter", date(2027, 1, 1), date(2027, 1, 3)}},
+		{"leaderboard quarter", date(2026, 3, 31), &TimeWindow{"this quarter", date(2026, 1, 1), date(2026, 4, 1)}},
+		{"leaderboard year", now, &TimeWindow{"this year", date(2026, 1, 1), date(2026, 10, 16)}},
+		{"leaderboard since 2026-01-01", now,
+			&TimeWindow{"since 2026-01-01", date(2026, 1, 1), date(2026, 10, 16)}},
+		{"leaderboard until 2026-01-31", now, &TimeWindow{"until 2026-01-31", time.Time{}, date(2026, 2, 1)}},
+		{"leaderboard 2026-01-01 to 2026-01-31", now,
+			&TimeWindow{"2026-01-01 to 2026-01-31", date(2026, 1, 1), date(2026, 2, 1)}},
+		{"leaderboard from 2026-01-01 to 2026-01-31", now,
+			&TimeWindow{"2026-01-01 to 2026-01-31", date(2026, 1, 1), date(2026, 2, 1)}},
+		{"leaderboard 2026-01-01..2026-01-01", now,
+			&TimeWindow{"2026-01-01 to 2026-01-01", date(2026, 1, 1), date(2026, 1, 2)}},
+		{"leaderboard :star: 2026-01-01..2026-01-31", now,
+			&TimeWindow{"2026-01-01 to 2026-01-31", date(2026, 1, 1), date(2026, 2, 1)}},
+		// Words with .. in them which aren't date ranges are left alone
+		{"leaderboard :a..b: wait...", now, nil},
+		{"leaderboard 2026-01-01..later", now, nil},
+	} {
+		window, err := parseTimeWindow(strings.Fields(test.text), test.now)
+		if err != nil {
+			t.Errorf("expected %q at %v to parse, got %v", test.text, test.now, err)
+			continue
+		}
+		if (window == nil) != (test.expected == nil) ||
+			window != nil && (window.Name != test.expected.Name || !window.Start.Equal(test.expected.Start) ||
+				!window.End.Equal(test.expected.End)) {
+			t.Errorf("expected %q at %v to be %+v, got %+v", test.text, test.now, test.expected, window)
+		}
+	}
+
+	for text, expected := range map[string]string{
+		"leaderboard since":                    "expected a date after `since`",
+		"leaderboard since yesterday":          "`yesterday` isn't a date",
+		"leaderboard until 2026-02-30":         "`2026-02-30` isn't a date",
+		"leaderboard 2026-01-01 to 2026-13-01": "`2026-13-01` isn't a date",
+		"leaderboard 2026-02-01 to 2026-01-01": "the end date `2026-01-01` is before the start date `2026-02-01`",
+		"leaderboard 2026-02-01..2026-01-01":   "the end date `2026-01-01` is before the start date `2026-02-01`",
+	} {
+		window, err := parseTimeWindow(strings.Fields(text), now)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q to fail with %q, got %+v (%v)", text, expected, window, err)
+		}
+	}
+}
+
+func TestWindowMatchInUsersTimeZone(t *testing.T) {
+	inLocalZone(t, time.UTC)
+	honolulu := mustLoadLocation(t, "Pacific/Honolulu")
+	user := &User{Username: "alice", Tz: "Pacific/Honolulu"}
+	request := func(text string) *Request {
+		return &Request{MessageEvent: &slack.MessageEvent{Msg: slack.Msg{Text: text}}}
+	}
+
+	// alice's day starts 10 hours after the server's, the same as her allowance
+	window, err := WindowMatch(request("leaderboard today"), user)
+	today := startOfDay(time.Now(), honolulu)
+	if err != nil || !window.Start.Equal(today) || !window.End.Equal(today.AddDate(0, 0, 1)) {
+		t.Errorf("expected today to start at %v in alice's time zone, got %+v (%v)", today, window, err)
+	}
+
+	window, err = WindowMatch(request("leaderboard 2026-01-01 to 2026-01-31"), user)
+	start, end := time.Date(2026, 1, 1, 0, 0, 0, 0, honolulu), time.Date(2026, 2, 1, 0, 0, 0, 0, honolulu)
+	if err != nil || !window.Start.Equal(start) || !window.End.Equal(end) {
+		t.Errorf("expected January in alice's time zone, got %+v (%v)", window, err)
+	}
+}